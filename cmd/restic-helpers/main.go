@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	_ "time/tzdata" // CRON_TZ= schedules must work on hosts without zoneinfo (e.g. Synology)
 
 	"github.com/catflyflyfly/restic-helpers/internal/cli"
 )
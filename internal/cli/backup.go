@@ -1,33 +1,167 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/catflyflyfly/restic-helpers/internal/config"
 	"github.com/catflyflyfly/restic-helpers/internal/notify"
+	"github.com/catflyflyfly/restic-helpers/internal/restic"
 	"github.com/catflyflyfly/restic-helpers/internal/retry"
+	"github.com/catflyflyfly/restic-helpers/internal/state"
 	"github.com/spf13/cobra"
 )
 
+// resticStopTimeout is how long restic gets to exit after an interrupt before it is killed
+const resticStopTimeout = 30 * time.Second
+
+// resticCacheDirEnv is the variable restic reads its cache directory from
+const resticCacheDirEnv = "RESTIC_CACHE_DIR"
+
+var (
+	backupWhen       string
+	backupCatchUp    bool
+	backupScheduled  bool
+	backupAll        bool
+	backupJobs       int
+	backupStatusFile string
+)
+
 var backupCmd = &cobra.Command{
-	Use:   "backup <repo-name>",
+	Use:   "backup <repo-or-group> | --all",
 	Short: "Run a backup for a repository",
-	Long:  `Executes a restic backup for the specified repository and prunes old snapshots.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runBackup,
+	Long: `Executes a restic backup for the specified repository and forgets old snapshots.
+
+The repository is also pruned if the last prune is older than prune.interval_days.
+Given a group from [groups] in config.toml, or --all for every repository but
+replicate_to targets, the repositories are backed up in parallel, [parallel]
+jobs (or --jobs) at a time. Each runs with its own retries and notifications
+and its output prefixed with its name; a failure does not stop the others. A
+summary table and one Telegram message report them all at the end.
+
+Only one run uses a repository at a time. A run that finds another in progress
+fails, or with --wait waits for it and with --skip skips the repository.
+Scheduled runs skip by default.
+
+After a successful backup, new snapshots are copied to the repositories in
+replicate_to (see replicate).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runBackup,
 }
 
 func init() {
+	// Set by schedulers whose trigger fires more often than the schedule
+	backupCmd.Flags().StringVar(&backupWhen, "when", "", "Only run if this cron expression fired within the last hour and no run started for it yet")
+	_ = backupCmd.Flags().MarkHidden("when")
+	// Set by schedulers that start backup at login or boot to catch up
+	backupCmd.Flags().BoolVar(&backupCatchUp, "catch-up", false, "Also run if a --when fire time was missed since the last successful backup")
+	_ = backupCmd.Flags().MarkHidden("catch-up")
+	// Set by every scheduler so scheduled runs wait for max_jitter
+	backupCmd.Flags().BoolVar(&backupScheduled, "scheduled", false, "Wait for the repository's max_jitter delay before starting")
+	_ = backupCmd.Flags().MarkHidden("scheduled")
+	backupCmd.Flags().BoolVar(&backupAll, "all", false, "Back up every configured repository except replicate_to targets")
+	backupCmd.Flags().IntVarP(&backupJobs, "jobs", "j", 0, "How many repositories to back up at once (default [parallel] jobs)")
+	// Set by backupRepos to learn whether each repository was skipped
+	backupCmd.Flags().StringVar(&backupStatusFile, "status-file", "", "Write whether the backup ran or was skipped to this file as JSON")
+	_ = backupCmd.Flags().MarkHidden("status-file")
+	addLockFlags(backupCmd)
 	rootCmd.AddCommand(backupCmd)
 }
 
 func runBackup(cmd *cobra.Command, args []string) error {
-	repoName := args[0]
+	if backupAll {
+		if len(args) > 0 {
+			return fmt.Errorf("--all backs up every repository and takes no name")
+		}
+		repoNames, err := allBackupRepos()
+		if err != nil {
+			return err
+		}
+		if len(repoNames) == 0 {
+			return fmt.Errorf("no repositories configured")
+		}
+		return backupRepos(cmd, repoNames)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires a repository or group name, or --all")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	repoNames, err := cfg.ResolveGroup(args[0])
+	if err != nil {
+		return err
+	}
+	if len(repoNames) == 1 && repoNames[0] == args[0] {
+		return runBackupRepo(cmd.Context(), args[0])
+	}
+	LogVerbose("Group %s: %v", args[0], repoNames)
+	return backupRepos(cmd, repoNames)
+}
+
+// runBackupRepo runs a backup, checking --when, waiting for jitter and taking
+// the run lock first
+func runBackupRepo(ctx context.Context, repoName string) error {
+	if backupWhen != "" {
+		due, err := whenDue(repoName, backupWhen, time.Now())
+		if err != nil {
+			return err
+		}
+		if !due && backupCatchUp {
+			due, err = catchUpBackup(ctx, repoName)
+			if err != nil {
+				return err
+			}
+		}
+		if !due {
+			LogVerbose("Skipping backup for %s: %q has no run due", repoName, backupWhen)
+			reportBackupStatus(backupSkipped, nil)
+			return nil
+		}
+	} else if backupCatchUp {
+		return fmt.Errorf("--catch-up requires --when")
+	}
+
+	if err := applyJitter(ctx, repoName, "backup", backupScheduled); err != nil {
+		return err
+	}
+
+	ran := false
+	err := withRunLock(ctx, repoName, "backup", lockMode(backupScheduled), func() error {
+		ran = true
+		return backupRepo(ctx, repoName)
+	})
+	if err == nil && !ran {
+		// Another run held the lock
+		reportBackupStatus(backupSkipped, nil)
+	}
+	return err
+}
+
+// catchUpBackup reports whether a missed --when backup should run now
+func catchUpBackup(ctx context.Context, repoName string) (bool, error) {
+	cfg, err := config.LoadWithVerbose(IsVerbose())
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return catchUp(ctx, repoName, "backup", backupWhen, time.Duration(cfg.CatchUp.Grace)*time.Second)
+}
 
+// backupRepo backs up a repository, forgets old snapshots and prunes when due,
+// with retries and notifications
+func backupRepo(ctx context.Context, repoName string) error {
 	LogVerbose("Starting backup for repository: %s", repoName)
 
 	LogVerbose("Loading paths configuration...")
@@ -36,28 +170,19 @@ func runBackup(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get paths: %w", err)
 	}
 
-	LogVerbose("Loading global configuration...")
-	cfg, err := config.LoadWithVerbose(IsVerbose())
+	cfg, repoCfg, err := loadConfigs(repoName)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	LogVerbose("Loading repository configuration...")
-	repoCfg, err := config.LoadRepo(repoName)
-	if err != nil {
-		return fmt.Errorf("failed to load repository config: %w", err)
-	}
-	if IsVerbose() {
-		repoCfg.PrettyPrint()
+	requiredFiles := repoCfg.RequiredFiles()
+	if repoCfg.PathsFile != "" {
+		requiredFiles = append(requiredFiles, repoCfg.PathsFile)
+	} else if len(repoCfg.Paths) == 0 {
+		return fmt.Errorf("no paths to back up for %s", repoName)
 	}
-
-	// Check required files
-	LogVerbose("Checking required files...")
-	for _, f := range []string{repoCfg.RepoFile, repoCfg.PasswordFile, repoCfg.PathsFile} {
-		if _, err := os.Stat(f); os.IsNotExist(err) {
-			return fmt.Errorf("required file missing: %s", f)
-		}
-		LogVerbose("  %s: ok", f)
+	if err := checkRequiredFiles(requiredFiles...); err != nil {
+		return err
 	}
 
 	// Create notifier with dry-run and verbose awareness
@@ -65,13 +190,9 @@ func runBackup(cmd *cobra.Command, args []string) error {
 
 	// Build backup command
 	LogVerbose("Building backup command...")
-	backupArgs := []string{
-		"backup",
-		fmt.Sprintf("--repository-file=%s", repoCfg.RepoFile),
-		fmt.Sprintf("--password-file=%s", repoCfg.PasswordFile),
-		fmt.Sprintf("--files-from=%s", repoCfg.PathsFile),
-		"--exclude-caches",
-	}
+	backupArgs := append([]string{"backup"}, repoCfg.RepoArgs()...)
+	// Progress and the summary are read from restic's JSON messages
+	backupArgs = append(backupArgs, "--json", "--exclude-caches")
 
 	// Add core exclude file if it exists
 	coreExcludeFile := filepath.Join(paths.ConfigDir, "core.exclude.txt")
@@ -80,40 +201,25 @@ func runBackup(cmd *cobra.Command, args []string) error {
 		backupArgs = append(backupArgs, fmt.Sprintf("--exclude-file=%s", coreExcludeFile))
 	}
 
-	// Add repo exclude file if it exists
-	if repoCfg.ExcludeFile != "" {
-		LogVerbose("  Adding repo exclude file: %s", repoCfg.ExcludeFile)
-		backupArgs = append(backupArgs, fmt.Sprintf("--exclude-file=%s", repoCfg.ExcludeFile))
+	// Add repo exclude file or patterns
+	if excludeArgs := repoCfg.ExcludeArgs(); len(excludeArgs) > 0 {
+		LogVerbose("  Adding repo excludes: %s", strings.Join(excludeArgs, " "))
+		backupArgs = append(backupArgs, excludeArgs...)
 	}
 
 	if IsVerbose() {
 		backupArgs = append(backupArgs, "--verbose")
 	}
 
-	// Get prune config
-	pruneConfig := cfg.Prune
-	if repoCfg.Prune != nil {
-		LogVerbose("Using repository-specific prune config")
-		pruneConfig = *repoCfg.Prune
-	} else {
-		LogVerbose("Using global prune config: keep_daily=%d, keep_weekly=%d, keep_monthly=%d",
-			pruneConfig.KeepDaily, pruneConfig.KeepWeekly, pruneConfig.KeepMonthly)
-	}
-
-	// Build prune command
-	LogVerbose("Building prune command...")
-	pruneArgs := []string{
-		"forget",
-		fmt.Sprintf("--repository-file=%s", repoCfg.RepoFile),
-		fmt.Sprintf("--password-file=%s", repoCfg.PasswordFile),
-		fmt.Sprintf("--keep-daily=%d", pruneConfig.KeepDaily),
-		fmt.Sprintf("--keep-weekly=%d", pruneConfig.KeepWeekly),
-		fmt.Sprintf("--keep-monthly=%d", pruneConfig.KeepMonthly),
-		"--prune",
-	}
+	// Paths go last, since inline paths follow "--"
+	backupArgs = append(backupArgs, repoCfg.PathArgs()...)
 
-	if IsVerbose() {
-		pruneArgs = append(pruneArgs, "--verbose")
+	policy := repoCfg.PrunePolicy(cfg.Prune)
+	forgetArgs := buildForgetArgs(repoCfg, policy)
+	pruneArgs := buildPruneArgs(repoCfg, policy)
+	due, err := pruneDue(repoName, policy)
+	if err != nil {
+		return err
 	}
 
 	if IsDryRun() {
@@ -123,12 +229,28 @@ func runBackup(cmd *cobra.Command, args []string) error {
 		// Let notifier print its own summary
 		notifier.PrintDryRunSummary()
 		fmt.Println()
-		fmt.Println("[dry-run] Prune command:")
+		fmt.Println("[dry-run] Forget command:")
+		fmt.Printf("restic %s\n", formatCmd(forgetArgs))
+		fmt.Println()
+		if due {
+			fmt.Println("[dry-run] Prune command (due):")
+		} else {
+			fmt.Printf("[dry-run] Prune command (not due, runs every %d days):\n", policy.IntervalDays)
+		}
 		fmt.Printf("restic %s\n", formatCmd(pruneArgs))
+		if len(repoCfg.ReplicateTo) > 0 {
+			fmt.Println()
+			return replicate(ctx, repoCfg, lockMode(backupScheduled))
+		}
 
 		return nil
 	}
 
+	env, err := repoCfg.ResticEnv()
+	if err != nil {
+		return err
+	}
+
 	// Ping healthcheck start
 	LogVerbose("Pinging healthcheck (start)...")
 	if err := notifier.PingHealthcheck("start"); err != nil {
@@ -138,40 +260,195 @@ func runBackup(cmd *cobra.Command, args []string) error {
 	// Run backup with retry
 	LogVerbose("Running backup...")
 	LogVerbose("Executing: restic %s", strings.Join(backupArgs, " "))
-	if err := retry.RunWithRetry("backup", func() error { return runResticCommand(backupArgs) }, cfg.Retry, LogVerbose); err != nil {
+	output, clearProgress := newBackupOutput()
+	backupErr := retry.RunWithRetryContext(ctx, "backup", func() error {
+		defer clearProgress()
+		output.Reset()
+		return runRestic(ctx, backupArgs, env, output, output.Stderr())
+	}, cfg.Retry, LogVerbose)
+	summary := output.Summary
+	if summary != nil {
+		fmt.Println(summary)
+	}
+	report := backupReport(output)
+
+	// A partial snapshot was saved all the same, which partial_snapshot = "warn" accepts
+	partial := errors.Is(backupErr, restic.ErrIncomplete)
+	if partial && repoCfg.PartialSnapshot == config.PartialWarn {
+		backupErr = nil
+	}
+	if backupErr != nil {
 		LogVerbose("Backup failed after retries, sending notifications...")
-		_ = notifier.SendTelegram(fmt.Sprintf("Backup failed for %s: %v", repoName, err))
-		_ = notifier.PingHealthcheck("fail")
-		return fmt.Errorf("backup failed: %w", err)
+		message := fmt.Sprintf("Backup failed for %s: %v", repoName, backupErr)
+		if report != "" {
+			message += "\n\n" + report
+		}
+		_ = notifier.SendTelegram(message)
+		_ = notifier.PingHealthcheckWithBody("fail", message)
+		return fmt.Errorf("backup failed: %w", backupErr)
+	}
+	if partial {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", restic.ErrIncomplete)
+		LogVerbose("Backup incomplete, sending notifications...")
+		_ = notifier.SendTelegram(fmt.Sprintf("Backup of %s finished with warnings: %v\n\n%s", repoName, restic.ErrIncomplete, report))
 	}
 	LogVerbose("Backup completed successfully")
+	recordSuccess(repoName, "backup")
+	if summary != nil {
+		recordBackup(repoName, *summary)
+	}
+	reportBackupStatus(backupOK, summary)
+
+	// Copy the new snapshot before forget can drop it. Replication notifies
+	// on its own, so a failure only shows in the exit code from here on.
+	var replicateErr error
+	if len(repoCfg.ReplicateTo) > 0 {
+		replicateErr = replicate(ctx, repoCfg, lockMode(backupScheduled))
+	}
 
-	// Run prune with retry
-	LogVerbose("Pruning old snapshots...")
-	LogVerbose("Executing: restic %s", strings.Join(pruneArgs, " "))
-	if err := retry.RunWithRetry("prune", func() error { return runResticCommand(pruneArgs) }, cfg.Retry, LogVerbose); err != nil {
-		LogVerbose("Prune failed after retries, sending notifications...")
-		_ = notifier.SendTelegram(fmt.Sprintf("Prune failed for %s: %v", repoName, err))
-		return fmt.Errorf("prune failed: %w", err)
+	// Forget after every backup, but only prune when the interval has passed
+	if err := runForget(ctx, repoName, forgetArgs, env, cfg, notifier); err != nil {
+		return err
+	}
+	if due {
+		if err := runPrune(ctx, repoName, pruneArgs, env, cfg, notifier); err != nil {
+			return err
+		}
+	} else {
+		LogVerbose("Prune not due yet (runs every %d days)", policy.IntervalDays)
 	}
-	LogVerbose("Prune completed successfully")
 
 	// Ping healthcheck success
 	LogVerbose("Pinging healthcheck (success)...")
-	if err := notifier.PingHealthcheck("success"); err != nil {
+	if err := notifier.PingHealthcheckWithBody("success", report); err != nil {
 		LogVerbose("Warning: failed to ping healthcheck: %v", err)
 	}
 
+	if replicateErr != nil {
+		return fmt.Errorf("backup of %s succeeded, but %w", repoName, replicateErr)
+	}
 	fmt.Printf("Backup completed successfully for %s\n", repoName)
 	return nil
 }
 
-func runResticCommand(args []string) error {
-	cmd := exec.Command("restic", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// maxReportedErrors is how many unreadable files a notification lists
+const maxReportedErrors = 10
+
+// backupReport describes a backup for notifications: its summary and the
+// files restic could not read
+func backupReport(output *restic.BackupOutput) string {
+	var lines []string
+	if output.Summary != nil {
+		lines = append(lines, output.Summary.String())
+	}
+	if n := len(output.Errors); n > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, fmt.Sprintf("Could not read %d files or directories:", n))
+		for i, backupErr := range output.Errors {
+			if i == maxReportedErrors {
+				lines = append(lines, fmt.Sprintf("  ... and %d more", n-i))
+				break
+			}
+			lines = append(lines, "  "+backupErr.String())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// recordBackup adds a backup summary to the history in the state directory.
+// Like recordSuccess, failing to record does not fail the run.
+func recordBackup(repoName string, summary restic.BackupSummary) {
+	paths, err := config.GetPaths()
+	if err == nil {
+		err = state.RecordBackup(paths.StateDir, repoName, summary, time.Now())
+	}
+	if err != nil {
+		LogVerbose("Warning: failed to record the backup summary for %s: %v", repoName, err)
+	}
+}
+
+// loadConfigs loads the global and repository configuration
+func loadConfigs(repoName string) (*config.Config, *config.RepoConfig, error) {
+	LogVerbose("Loading global configuration...")
+	cfg, err := config.LoadWithVerbose(IsVerbose())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	LogVerbose("Loading repository configuration...")
+	repoCfg, err := config.LoadRepo(repoName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load repository config: %w", err)
+	}
+	if IsVerbose() {
+		repoCfg.PrettyPrint()
+	}
+	LogVerbose("Repository password: %s", repoCfg.Password)
+	for _, key := range slices.Sorted(maps.Keys(repoCfg.Environment)) {
+		LogVerbose("Repository env %s: %s", key, repoCfg.Environment[key])
+	}
+
+	// Repository overrides apply to everything that reads the global config
+	cfg.Retry = repoCfg.RetryPolicy(cfg.Retry)
+	cfg.Telegram = repoCfg.TelegramSettings(cfg.Telegram)
+
+	return cfg, repoCfg, nil
+}
+
+// checkRequiredFiles returns an error if any of the files is missing
+func checkRequiredFiles(files ...string) error {
+	LogVerbose("Checking required files...")
+	for _, f := range files {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			return fmt.Errorf("required file missing: %s", f)
+		}
+		LogVerbose("  %s: ok", f)
+	}
+	return nil
+}
+
+// runResticCommand runs restic with env added to the environment, interrupting
+// it when ctx is cancelled so it can release its repository lock before exiting
+func runResticCommand(ctx context.Context, args []string, env []string) error {
+	return runRestic(ctx, args, env, os.Stdout, os.Stderr)
+}
+
+// runRestic is runResticCommand with restic's output written to stdout and
+// stderr. Known exit codes are returned as *restic.ExitError, and marked
+// permanent for retry if another attempt cannot fix them.
+func runRestic(ctx context.Context, args []string, env []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "restic", args...)
+	env = append(resticCacheEnv(), env...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = resticStopTimeout
+
+	err := restic.Classify(cmd.Run())
+	if err != nil && !restic.Transient(err) {
+		return retry.Permanent(err)
+	}
+	return err
+}
 
-	return cmd.Run()
+// resticCacheEnv keeps restic's cache in the cache directory, unless
+// RESTIC_CACHE_DIR is already set
+func resticCacheEnv() []string {
+	if os.Getenv(resticCacheDirEnv) != "" {
+		return nil
+	}
+	paths, err := config.GetPaths()
+	if err != nil {
+		return nil
+	}
+	return []string{resticCacheDirEnv + "=" + paths.CacheDir}
 }
 
 func formatCmd(args []string) string {
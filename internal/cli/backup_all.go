@@ -0,0 +1,293 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/notify"
+	"github.com/catflyflyfly/restic-helpers/internal/restic"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Outcomes of a repository's backup in a multi-repository run
+const (
+	backupOK      = "ok"
+	backupFailed  = "failed"
+	backupSkipped = "skipped"
+	backupDryRun  = "dry-run"
+)
+
+// repoBackup is the outcome of one repository's backup in a multi-repository run
+type repoBackup struct {
+	repo     string
+	status   string
+	duration time.Duration
+	// summary is the backup saved by the run, nil if it saved no snapshot
+	summary *restic.BackupSummary
+}
+
+// childStatus is how a repository's backup process tells backupRepos whether
+// it backed up or skipped the repository
+type childStatus struct {
+	Status  string                `json:"status"`
+	Summary *restic.BackupSummary `json:"summary,omitempty"`
+}
+
+// reportBackupStatus writes the outcome of a backup to --status-file, if set.
+// A run that exits without one counts as ok.
+func reportBackupStatus(status string, summary *restic.BackupSummary) {
+	if backupStatusFile == "" {
+		return
+	}
+	data, err := json.Marshal(childStatus{Status: status, Summary: summary})
+	if err == nil {
+		err = os.WriteFile(backupStatusFile, data, 0600)
+	}
+	if err != nil {
+		LogVerbose("Warning: failed to write the backup status: %v", err)
+	}
+}
+
+// backupRepos backs up repositories in parallel, each in its own
+// restic-helpers process with its own retries, lock and notifications, and
+// its output prefixed with its name. A failing repository does not stop the
+// others; a summary table and one Telegram message report them all.
+func backupRepos(cmd *cobra.Command, repoNames []string) error {
+	cfg, err := config.LoadWithVerbose(IsVerbose())
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	jobs := cfg.Parallel.Jobs
+	if cmd.Flags().Changed("jobs") {
+		jobs = backupJobs
+	}
+	if jobs < 1 {
+		return fmt.Errorf("jobs must be at least 1, not %d", jobs)
+	}
+
+	binaryPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+	args := forwardedFlags(cmd)
+
+	// Each process reports whether it skipped its repository in a file here
+	statusDir, err := os.MkdirTemp("", "restic-helpers-backup-")
+	if err != nil {
+		return fmt.Errorf("failed to create status directory: %w", err)
+	}
+	defer os.RemoveAll(statusDir)
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would back up %d repositories, %d at a time: %s\n\n", len(repoNames), jobs, strings.Join(repoNames, ", "))
+	}
+
+	// Stopping restic-helpers stops every backup it started
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	var mu sync.Mutex
+	results := make([]repoBackup, len(repoNames))
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, repoName := range repoNames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = runChildBackup(ctx, binaryPath, repoName, args, filepath.Join(statusDir, repoName+".json"), &mu)
+		}()
+	}
+	wg.Wait()
+
+	table := formatBackupTable(results)
+	fmt.Println()
+	fmt.Print(table)
+
+	var failed []string
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.status]++
+		if result.status == backupFailed {
+			failed = append(failed, result.repo)
+		}
+	}
+
+	message := fmt.Sprintf("Backup of %d repositories: %d ok, %d failed, %d skipped\n\n%s",
+		len(results), counts[backupOK], len(failed), counts[backupSkipped], table)
+	notifier := notify.New(&cfg.Telegram, "", IsDryRun(), IsVerbose())
+	if err := notifier.SendTelegram(message); err != nil {
+		LogVerbose("Warning: failed to send telegram message: %v", err)
+	}
+
+	if len(failed) > 0 {
+		// Each failure was already printed with its repository's output
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d backups failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// allBackupRepos returns every configured repository except the targets of
+// replicate_to, which get their snapshots from restic copy
+func allBackupRepos() ([]string, error) {
+	repoNames, err := config.ListRepos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+
+	targets := make(map[string]bool)
+	for _, repoName := range repoNames {
+		repoCfg, err := config.LoadRepo(repoName)
+		if err != nil {
+			// The repository's own backup reports the error
+			continue
+		}
+		for _, target := range repoCfg.ReplicateTo {
+			targets[target] = true
+		}
+	}
+
+	var names []string
+	for _, repoName := range repoNames {
+		if targets[repoName] {
+			LogVerbose("Skipping %s: it is a replicate_to target", repoName)
+			continue
+		}
+		names = append(names, repoName)
+	}
+	return names, nil
+}
+
+// forwardedFlags returns the flags set on the command line that each
+// repository's backup process needs too
+func forwardedFlags(cmd *cobra.Command) []string {
+	var args []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name != "all" && f.Name != "jobs" && f.Name != "status-file" {
+			args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+		}
+	})
+	return args
+}
+
+// runChildBackup backs up one repository in a restic-helpers process, with
+// its output prefixed by the repository name and its outcome read from
+// statusFile
+func runChildBackup(ctx context.Context, binaryPath, repoName string, args []string, statusFile string, mu *sync.Mutex) repoBackup {
+	result := repoBackup{repo: repoName}
+	prefix := repoName + " | "
+	stdout := &prefixWriter{prefix: prefix, w: os.Stdout, mu: mu}
+	stderr := &prefixWriter{prefix: prefix, w: os.Stderr, mu: mu}
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	child := exec.CommandContext(ctx, binaryPath, append([]string{"backup", repoName, "--status-file=" + statusFile}, args...)...)
+	child.Stdout = stdout
+	child.Stderr = stderr
+	// The child interrupts restic in turn and waits for it
+	child.Cancel = func() error {
+		return child.Process.Signal(os.Interrupt)
+	}
+	child.WaitDelay = 2 * resticStopTimeout
+
+	start := time.Now()
+	err := child.Run()
+	result.duration = time.Since(start).Round(time.Second)
+
+	switch {
+	case err != nil:
+		result.status = backupFailed
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+		}
+	case IsDryRun():
+		result.status = backupDryRun
+	default:
+		status := readChildStatus(statusFile)
+		result.status = status.Status
+		result.summary = status.Summary
+	}
+	return result
+}
+
+// readChildStatus returns the outcome a backup process that exited cleanly
+// wrote to statusFile, or ok if it wrote none
+func readChildStatus(statusFile string) childStatus {
+	var status childStatus
+	data, err := os.ReadFile(statusFile)
+	if err != nil || json.Unmarshal(data, &status) != nil || status.Status == "" {
+		return childStatus{Status: backupOK}
+	}
+	return status
+}
+
+// formatBackupTable formats the outcome of every repository's backup
+func formatBackupTable(results []repoBackup) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tSTATUS\tDURATION\tADDED\tSNAPSHOT")
+	for _, result := range results {
+		added, snapshot := "-", "-"
+		if result.summary != nil {
+			added = restic.FormatBytes(result.summary.DataAdded)
+			snapshot = restic.ShortID(result.summary.SnapshotID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.repo, result.status, result.duration, added, snapshot)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// prefixWriter writes complete lines to w, each starting with prefix. The
+// writers of all repositories share mu, so their lines do not mix.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	line   []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.line = append(p.line, b...)
+	for {
+		i := bytes.IndexByte(p.line, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.line[:i+1])
+		p.line = p.line[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a last line that did not end in a newline
+func (p *prefixWriter) Flush() {
+	if len(p.line) > 0 {
+		p.writeLine(append(p.line, '\n'))
+		p.line = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = io.WriteString(p.w, p.prefix+string(line))
+}
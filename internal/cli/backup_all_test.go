@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"one line", []string{"saved\n"}, "laptop | saved\n"},
+		{"split line", []string{"sav", "ed\n"}, "laptop | saved\n"},
+		{"several lines", []string{"a\nb\n"}, "laptop | a\nlaptop | b\n"},
+		{"unterminated", []string{"a\nb"}, "laptop | a\nlaptop | b\n"},
+		{"empty line", []string{"\n"}, "laptop | \n"},
+		{"nothing", nil, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := &prefixWriter{prefix: "laptop | ", w: &buf, mu: &sync.Mutex{}}
+		for _, s := range tt.writes {
+			if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+				t.Fatalf("%s: Write(%q) = %d, %v", tt.name, s, n, err)
+			}
+		}
+		w.Flush()
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBackupTable(t *testing.T) {
+	table := formatBackupTable([]repoBackup{
+		{repo: "laptop", status: backupOK, duration: 65 * time.Second, summary: &restic.BackupSummary{DataAdded: 2048, SnapshotID: "4f2a1b3c9d8e"}},
+		{repo: "nas", status: backupFailed, duration: 3 * time.Second},
+	})
+
+	want := []string{
+		"REPO    STATUS  DURATION  ADDED      SNAPSHOT",
+		"laptop  ok      1m5s      2.000 KiB  4f2a1b3c",
+		"nas     failed  3s        -          -",
+	}
+	if got := strings.Split(strings.TrimSuffix(table, "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("formatBackupTable() =\n%s\nwant\n%s", table, strings.Join(want, "\n"))
+	}
+}
+
+func TestForwardedFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--all"}, nil},
+		{[]string{"--all", "-j", "4", "--status-file=/tmp/s.json"}, nil},
+		{[]string{"--all", "--wait", "--jobs=2"}, []string{"--wait=true"}},
+		{[]string{"--all", "--when", "0 2 * * *"}, []string{"--when=0 2 * * *"}},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{Use: "backup"}
+		cmd.Flags().Bool("all", false, "")
+		cmd.Flags().IntP("jobs", "j", 0, "")
+		cmd.Flags().String("status-file", "", "")
+		cmd.Flags().Bool("wait", false, "")
+		cmd.Flags().String("when", "", "")
+		if err := cmd.Flags().Parse(tt.args); err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.args, err)
+		}
+
+		got := forwardedFlags(cmd)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("forwardedFlags(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestReadChildStatus(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		content  string
+		status   string
+		snapshot string
+	}{
+		{"skipped", `{"status":"skipped"}`, backupSkipped, ""},
+		{"ok with summary", `{"status":"ok","summary":{"snapshot_id":"4f2a1b3c9d8e"}}`, backupOK, "4f2a1b3c9d8e"},
+		{"missing", "", backupOK, ""},
+		{"malformed", `{"status":`, backupOK, ""},
+		{"no status", `{}`, backupOK, ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".json")
+		if tt.content != "" {
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := readChildStatus(path)
+		if got.Status != tt.status {
+			t.Errorf("%s: status = %q, want %q", tt.name, got.Status, tt.status)
+		}
+		var snapshot string
+		if got.Summary != nil {
+			snapshot = got.Summary.SnapshotID
+		}
+		if snapshot != tt.snapshot {
+			t.Errorf("%s: snapshot = %q, want %q", tt.name, snapshot, tt.snapshot)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/catflyflyfly/restic-helpers/internal/state"
+)
+
+// missedRun reports whether a fire time of expr passed since the last
+// successful run of a task, or since its job was installed if it never succeeded
+func missedRun(repoName, task, expr string) (bool, error) {
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return false, err
+	}
+
+	paths, err := config.GetPaths()
+	if err != nil {
+		return false, fmt.Errorf("failed to get paths: %w", err)
+	}
+
+	s, err := state.Load(paths.StateDir, repoName)
+	if err != nil {
+		return false, err
+	}
+
+	since, ok := s.CatchUpSince(task)
+	if !ok {
+		LogVerbose("No successful or scheduled %s recorded for %s, nothing to catch up", task, repoName)
+		return false, nil
+	}
+
+	missed := schedule.Missed(since, time.Now())
+	LogVerbose("Catching up %s for %s since: %s (missed: %t)", task, repoName, since.Local().Format(previewTimeFormat), missed)
+	return missed, nil
+}
+
+// catchUp reports whether a missed run of a task should start now. It waits
+// out the grace window first and checks again, so logging in or waking up
+// does not start a backup right away and a run that finished meanwhile wins.
+func catchUp(ctx context.Context, repoName, task, expr string, grace time.Duration) (bool, error) {
+	missed, err := missedRun(repoName, task, expr)
+	if err != nil || !missed {
+		return false, err
+	}
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would catch up missed %s for %s after %v\n", task, repoName, grace)
+		return true, nil
+	}
+
+	fmt.Printf("Missed scheduled %s for %s, catching up in %v\n", task, repoName, grace)
+	if !sleepContext(ctx, grace) {
+		return false, ctx.Err()
+	}
+
+	return missedRun(repoName, task, expr)
+}
+
+// recordScheduled records when the job of a task was installed, so catch-up
+// works before its first success. With keep, an earlier record stays. Like
+// recordSuccess, failing to record does not fail the run.
+func recordScheduled(repoName, task string, keep bool) {
+	paths, err := config.GetPaths()
+	if err == nil {
+		err = state.RecordScheduled(paths.StateDir, repoName, task, time.Now(), keep)
+	}
+	if err != nil {
+		LogVerbose("Warning: failed to record the %s schedule for %s: %v", task, repoName, err)
+	}
+}
+
+// sleepContext sleeps for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// recordSuccess records a successful run of a task for catch-up. Failing to
+// record only affects catch-up, so it does not fail the run.
+func recordSuccess(repoName, task string) {
+	paths, err := config.GetPaths()
+	if err == nil {
+		err = state.RecordSuccess(paths.StateDir, repoName, task, time.Now())
+	}
+	if err != nil {
+		LogVerbose("Warning: failed to record %s for %s: %v", task, repoName, err)
+	}
+}
@@ -1,66 +1,66 @@
 package cli
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
 	"strings"
 
-	"github.com/catflyflyfly/restic-helpers/internal/config"
 	"github.com/catflyflyfly/restic-helpers/internal/notify"
+	"github.com/catflyflyfly/restic-helpers/internal/retry"
 	"github.com/spf13/cobra"
 )
 
+var checkScheduled bool
+
 var checkCmd = &cobra.Command{
-	Use:   "check <repo-name>",
+	Use:   "check <repo-or-group>",
 	Short: "Verify repository integrity",
-	Long:  `Runs restic check to verify the integrity of a repository.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runCheck,
+	Long: `Runs restic check to verify the integrity of a repository, or of every
+repository in a group from [groups] in config.toml.
+
+A failed check is retried with the same backoff as backup
+(see [retry] in config.toml), both when run directly and from the daemon.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCheck,
 }
 
 func init() {
+	// Set by schedulers so scheduled runs wait for max_jitter
+	checkCmd.Flags().BoolVar(&checkScheduled, "scheduled", false, "Wait for the repository's max_jitter delay before starting")
+	_ = checkCmd.Flags().MarkHidden("scheduled")
+	addLockFlags(checkCmd)
 	rootCmd.AddCommand(checkCmd)
 }
 
 func runCheck(cmd *cobra.Command, args []string) error {
-	repoName := args[0]
+	return forEachRepo(args[0], func(repoName string) error {
+		if err := applyJitter(cmd.Context(), repoName, "check", checkScheduled); err != nil {
+			return err
+		}
+		return withRunLock(cmd.Context(), repoName, "check", lockMode(checkScheduled), func() error {
+			return checkRepo(cmd.Context(), repoName)
+		})
+	})
+}
 
+// checkRepo verifies the integrity of a repository, with retries and notifications
+func checkRepo(ctx context.Context, repoName string) error {
 	LogVerbose("Starting check for repository: %s", repoName)
 
-	LogVerbose("Loading global configuration...")
-	cfg, err := config.LoadWithVerbose(IsVerbose())
+	cfg, repoCfg, err := loadConfigs(repoName)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	LogVerbose("Loading repository configuration...")
-	repoCfg, err := config.LoadRepo(repoName)
-	if err != nil {
-		return fmt.Errorf("failed to load repository config: %w", err)
-	}
-	if IsVerbose() {
-		repoCfg.PrettyPrint()
+		return err
 	}
 
-	// Check required files
-	LogVerbose("Checking required files...")
-	for _, f := range []string{repoCfg.RepoFile, repoCfg.PasswordFile} {
-		if _, err := os.Stat(f); os.IsNotExist(err) {
-			return fmt.Errorf("required file missing: %s", f)
-		}
-		LogVerbose("  %s: ok", f)
+	if err := checkRequiredFiles(repoCfg.RequiredFiles()...); err != nil {
+		return err
 	}
 
 	notifier := notify.New(&cfg.Telegram, repoCfg.Healthcheck, IsDryRun(), IsVerbose())
 
 	// Build check command
 	LogVerbose("Building check command...")
-	checkArgs := []string{
-		"check",
-		fmt.Sprintf("--repository-file=%s", repoCfg.RepoFile),
-		fmt.Sprintf("--password-file=%s", repoCfg.PasswordFile),
-	}
+	checkArgs := append([]string{"check"}, repoCfg.RepoArgs()...)
 
 	if IsVerbose() {
 		checkArgs = append(checkArgs, "--verbose")
@@ -73,20 +73,21 @@ func runCheck(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	env, err := repoCfg.ResticEnv()
+	if err != nil {
+		return err
+	}
+
 	LogVerbose("Running check...")
 	LogVerbose("Executing: restic %s", strings.Join(checkArgs, " "))
-
-	resticCmd := exec.Command("restic", checkArgs...)
-	resticCmd.Stdout = os.Stdout
-	resticCmd.Stderr = os.Stderr
-
-	if err := resticCmd.Run(); err != nil {
+	if err := retry.RunWithRetryContext(ctx, "check", func() error { return runResticCommand(ctx, checkArgs, env) }, cfg.Retry, LogVerbose); err != nil {
 		LogVerbose("Check failed, sending notifications...")
 		_ = notifier.SendTelegram(fmt.Sprintf("Check failed for %s: %v", repoName, err))
 		return fmt.Errorf("restic check failed: %w", err)
 	}
 
 	LogVerbose("Check completed successfully")
+	recordSuccess(repoName, "check")
 	fmt.Printf("Repository %s is healthy\n", repoName)
 	return nil
 }
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema [" + strings.Join(config.SchemaKinds, "|") + "]",
+	Short: "Print a JSON Schema of a config file",
+	Long: `Prints a JSON Schema of config.toml and secret.toml (the default), repo.toml,
+prune.toml or schedule.toml, for editors that validate TOML against a schema.
+
+Examples:
+  restic-helpers config schema > ~/.config/restic-helpers/config.schema.json
+  restic-helpers config schema repo > ~/.config/restic-helpers/repo.schema.json`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: config.SchemaKinds,
+	RunE:      runConfigSchema,
+}
+
+func init() {
+	configCmd.AddCommand(configSchemaCmd)
+}
+
+func runConfigSchema(cmd *cobra.Command, args []string) error {
+	kind := "config"
+	if len(args) > 0 {
+		kind = args[0]
+	}
+
+	schema, err := config.Schema(kind)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,310 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	robfigcron "github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonShutdownTimeout time.Duration
+	daemonCatchUp         bool
+)
+
+// wakeThreshold is how far the wall clock may jump between two ticks of the
+// wake detector before the daemon assumes the host was asleep
+const wakeThreshold = 2 * time.Minute
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run scheduled backups, checks and prunes in the foreground",
+	Long: `Runs an in-process scheduler for hosts without launchd or systemd, e.g. containers.
+
+Schedules are read from repos/<repo-name>/schedule.toml:
+
+  backup = "0 2 * * *"
+  check  = "0 4 * * 0"
+  prune  = "0 5 * * 0"
+
+Runs of the same repository never overlap; a run that is due while another
+is still going is skipped. On SIGTERM or SIGINT the daemon waits for running
+jobs up to --shutdown-timeout, then interrupts restic and waits for it to exit.
+
+With --catch-up, tasks whose last fire time passed without a successful run
+are started on startup and after the host wakes from sleep, once the
+catch_up.grace window from config.toml has passed.`,
+	Args: cobra.NoArgs,
+	RunE: runDaemon,
+}
+
+func init() {
+	daemonCmd.Flags().DurationVar(&daemonShutdownTimeout, "shutdown-timeout", 5*time.Minute, "How long to wait for running jobs before interrupting restic")
+	daemonCmd.Flags().BoolVar(&daemonCatchUp, "catch-up", false, "Run tasks that were missed while the daemon was stopped or the host was asleep")
+	rootCmd.AddCommand(daemonCmd)
+}
+
+// daemonTask is an operation the daemon can run on a schedule
+type daemonTask struct {
+	name string
+	expr func(*config.ScheduleConfig) string
+	run  func(ctx context.Context, repoName string) error
+	// jitter delays scheduled runs by the repository's max_jitter
+	jitter bool
+}
+
+var daemonTasks = []daemonTask{
+	{"backup", func(s *config.ScheduleConfig) string { return s.Backup }, backupRepo, true},
+	{"check", func(s *config.ScheduleConfig) string { return s.Check }, checkRepo, true},
+	{"prune", func(s *config.ScheduleConfig) string { return s.Prune }, pruneRepo, false},
+}
+
+// daemon runs tasks and keeps runs of the same repository from overlapping
+type daemon struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stopping is done once shutdown starts; runs still waiting to start give up
+	stopping context.Context
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+
+	// catchUps tracks running catch-up passes so shutdown can wait for them
+	catchUps sync.WaitGroup
+}
+
+// scheduledTask is a task scheduled for a repository
+type scheduledTask struct {
+	repoName string
+	task     daemonTask
+	expr     string
+}
+
+func newDaemon() *daemon {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &daemon{ctx: ctx, cancel: cancel, stopping: context.Background(), locks: make(map[string]*sync.Mutex)}
+}
+
+// repoLock returns the lock for a repository
+func (d *daemon) repoLock(repoName string) *sync.Mutex {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.locks[repoName] == nil {
+		d.locks[repoName] = &sync.Mutex{}
+	}
+	return d.locks[repoName]
+}
+
+// run runs a task unless another run of the same repository is in progress
+func (d *daemon) run(repoName string, task daemonTask) {
+	lock := d.repoLock(repoName)
+	if !lock.TryLock() {
+		logDaemon("Skipping %s for %s: another run is in progress", task.name, repoName)
+		return
+	}
+	defer lock.Unlock()
+
+	if task.jitter {
+		if err := applyJitter(d.stopping, repoName, task.name, true); err != nil {
+			logDaemon("Skipping %s for %s: %v", task.name, repoName, err)
+			return
+		}
+	}
+
+	logDaemon("Starting %s for %s", task.name, repoName)
+	// The run lock also keeps out runs started outside the daemon
+	err := withRunLock(d.ctx, repoName, task.name, lockSkip, func() error {
+		return task.run(d.ctx, repoName)
+	})
+	if err != nil {
+		logDaemon("%s failed for %s: %v", task.name, repoName, err)
+		return
+	}
+	logDaemon("Finished %s for %s", task.name, repoName)
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	LogVerbose("Listing repositories...")
+	repos, err := config.ListRepos()
+	if err != nil {
+		return fmt.Errorf("failed to list repositories: %w", err)
+	}
+
+	d := newDaemon()
+	c := robfigcron.New()
+
+	var scheduled []scheduledTask
+	for _, repoName := range repos {
+		repoCfg, err := config.LoadRepo(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to load repository config for %s: %w", repoName, err)
+		}
+		if repoCfg.Schedule == nil {
+			LogVerbose("No schedule.toml for %s, skipping", repoName)
+			continue
+		}
+
+		for _, task := range daemonTasks {
+			expr := task.expr(repoCfg.Schedule)
+			if expr == "" {
+				continue
+			}
+
+			schedule, err := cron.Parse(expr)
+			if err != nil {
+				return fmt.Errorf("invalid %s schedule for %s: %w", task.name, repoName, err)
+			}
+
+			next := schedule.Next(time.Now()).Local().Format(previewTimeFormat)
+			if IsDryRun() {
+				fmt.Printf("[dry-run] Would schedule %s for %s: %s (next: %s)\n", task.name, repoName, expr, next)
+				if task.jitter {
+					if delay, max, err := repoJitter(repoName, task.name); err == nil && max > 0 {
+						fmt.Printf("[dry-run]   Would wait %v after each run is due (max_jitter %v)\n", delay, max)
+					}
+				}
+			} else {
+				LogVerbose("Scheduling %s for %s: %s (next: %s)", task.name, repoName, expr, next)
+				c.Schedule(schedule, robfigcron.FuncJob(func() { d.run(repoName, task) }))
+			}
+			scheduled = append(scheduled, scheduledTask{repoName, task, expr})
+		}
+	}
+
+	if len(scheduled) == 0 {
+		return fmt.Errorf("no schedules found; add schedule.toml to a repository")
+	}
+
+	var grace time.Duration
+	if daemonCatchUp {
+		cfg, err := config.LoadWithVerbose(IsVerbose())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		grace = time.Duration(cfg.CatchUp.Grace) * time.Second
+	}
+
+	if IsDryRun() {
+		if daemonCatchUp {
+			fmt.Printf("[dry-run] Would catch up missed tasks on startup and wake after %v\n", grace)
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	d.stopping = ctx
+	c.Start()
+	logDaemon("Daemon started with %d scheduled jobs", len(scheduled))
+
+	if daemonCatchUp {
+		// Tasks that never succeeded are caught up from the daemon's first start
+		for _, st := range scheduled {
+			recordScheduled(st.repoName, st.task.name, true)
+		}
+		d.startCatchUp(ctx, scheduled, grace)
+		go d.watchWake(ctx, scheduled, grace)
+	}
+
+	<-ctx.Done()
+	logDaemon("Shutting down, waiting for running jobs...")
+
+	stopped := make(chan struct{})
+	go func() {
+		<-c.Stop().Done()
+		d.catchUps.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(daemonShutdownTimeout):
+		logDaemon("Running jobs did not finish within %v, interrupting restic...", daemonShutdownTimeout)
+		d.cancel()
+		<-stopped
+	}
+	d.cancel()
+
+	logDaemon("Daemon stopped")
+	return nil
+}
+
+// startCatchUp runs the tasks whose last fire time passed without a
+// successful run. Missed tasks are found right away, but only started once
+// the grace window has passed and they are still missed.
+func (d *daemon) startCatchUp(ctx context.Context, scheduled []scheduledTask, grace time.Duration) {
+	var missed []scheduledTask
+	for _, st := range scheduled {
+		// Intervals have no fixed fire time that could be missed
+		if schedule, err := cron.Parse(st.expr); err != nil || schedule.Every > 0 {
+			continue
+		}
+		ok, err := missedRun(st.repoName, st.task.name, st.expr)
+		if err != nil {
+			logDaemon("Failed to check missed %s for %s: %v", st.task.name, st.repoName, err)
+			continue
+		}
+		if ok {
+			logDaemon("Missed scheduled %s for %s, catching up in %v", st.task.name, st.repoName, grace)
+			missed = append(missed, st)
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	d.catchUps.Add(1)
+	go func() {
+		defer d.catchUps.Done()
+		if !sleepContext(ctx, grace) {
+			return
+		}
+		// Run one at a time so tasks of the same repository do not skip each other
+		for _, st := range missed {
+			if ctx.Err() != nil {
+				return
+			}
+			if ok, err := missedRun(st.repoName, st.task.name, st.expr); err != nil || !ok {
+				continue
+			}
+			d.run(st.repoName, st.task)
+		}
+	}()
+}
+
+// watchWake starts a catch-up pass whenever the host wakes from sleep. The
+// monotonic clock stops while asleep, so a wake shows up as a jump of the
+// wall clock between two ticks.
+func (d *daemon) watchWake(ctx context.Context, scheduled []scheduledTask, grace time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	last := time.Now().Round(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now().Round(0)
+			if now.Sub(last) > wakeThreshold {
+				logDaemon("Woke up after %v", now.Sub(last).Round(time.Second))
+				d.startCatchUp(ctx, scheduled, grace)
+			}
+			last = now
+		}
+	}
+}
+
+// logDaemon prints a timestamped message; the daemon runs unattended, so
+// these are printed even without --verbose
+func logDaemon(format string, args ...interface{}) {
+	fmt.Printf("%s "+format+"\n", append([]interface{}{time.Now().Format(time.DateTime)}, args...)...)
+}
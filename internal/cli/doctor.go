@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/catflyflyfly/restic-helpers/internal/doctor"
+	"github.com/spf13/cobra"
+)
+
+var doctorJSON bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [repo-name...]",
+	Short: "Check restic and the configuration for problems",
+	Long: `Checks that restic is installed and recent enough, and goes through every
+repository (or the given ones) looking for problems that would make a scheduled
+backup fail: an empty or example repository, a missing, empty or world-readable
+password, backup paths that do not exist, invalid exclude patterns, malformed
+healthcheck URLs and incomplete Telegram settings.
+
+Each check passes, warns or fails, with a hint on how to fix it. The exit code
+is non-zero if any check failed.
+
+Examples:
+  restic-helpers doctor
+  restic-helpers doctor myrepo
+  restic-helpers doctor --json   # For CI`,
+	RunE: runDoctor,
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [repo-name...]",
+	Short: "Check the configuration for problems (same as doctor)",
+	Long:  doctorCmd.Long,
+	RunE:  runDoctor,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{doctorCmd, configValidateCmd} {
+		cmd.Flags().BoolVar(&doctorJSON, "json", false, "Output as JSON")
+	}
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(doctorCmd, configCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	LogVerbose("Running checks")
+	report, err := doctor.New().Run(args...)
+	if err != nil {
+		return err
+	}
+
+	if doctorJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printDoctorReport(report)
+	}
+
+	if report.Failed() {
+		// The report already says what is wrong
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d checks failed", report.Count(doctor.Fail))
+	}
+	return nil
+}
+
+// printDoctorReport prints the results grouped by scope, with hints under
+// warnings and failures
+func printDoctorReport(report *doctor.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	scope := ""
+	for _, result := range report.Results {
+		if result.Scope != scope {
+			if scope != "" {
+				fmt.Fprintln(w)
+			}
+			scope = result.Scope
+			fmt.Fprintln(w, scope)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", result.Status, result.Check, result.Message)
+		if result.Hint != "" && result.Status != doctor.Pass {
+			fmt.Fprintf(w, "  \t\t-> %s\n", result.Hint)
+		}
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d passed, %d warnings, %d failed\n",
+		report.Count(doctor.Pass), report.Count(doctor.Warn), report.Count(doctor.Fail))
+}
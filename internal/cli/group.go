@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+)
+
+// forEachRepo runs fn for a repository, or for every repository of a group
+// defined in [groups]. A failing repository does not stop the others; the
+// failures are returned together.
+func forEachRepo(name string, fn func(repoName string) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	repoNames, err := cfg.ResolveGroup(name)
+	if err != nil {
+		return err
+	}
+	if len(repoNames) == 1 && repoNames[0] == name {
+		return fn(name)
+	}
+
+	LogVerbose("Group %s: %v", name, repoNames)
+	var errs []error
+	for _, repoName := range repoNames {
+		if err := fn(repoName); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", repoName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+)
+
+// repoJitter returns the delay before a scheduled task of a repository and
+// the max_jitter it was drawn from. Both are zero without max_jitter.
+func repoJitter(repoName, task string) (time.Duration, time.Duration, error) {
+	repoCfg, err := config.LoadRepo(repoName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load repository config: %w", err)
+	}
+	if repoCfg.Schedule == nil || repoCfg.Schedule.MaxJitter <= 0 {
+		return 0, 0, nil
+	}
+
+	// The hostname keeps machines sharing a schedule apart; without one
+	// the delay is still stable per repository
+	hostname, _ := os.Hostname()
+	max := time.Duration(repoCfg.Schedule.MaxJitter) * time.Second
+	return scheduler.Jitter(scheduler.JitterSeed(hostname, repoName, task), max), max, nil
+}
+
+// applyJitter sleeps for the jitter delay before a scheduled task. Runs
+// started by hand do not wait; with --dry-run they show what a scheduled
+// run would wait instead.
+func applyJitter(ctx context.Context, repoName, task string, scheduled bool) error {
+	delay, max, err := repoJitter(repoName, task)
+	if err != nil || max == 0 {
+		return err
+	}
+
+	if !scheduled {
+		if IsDryRun() {
+			fmt.Printf("[dry-run] Scheduled %s would wait %v (max_jitter %v)\n", task, delay, max)
+		}
+		return nil
+	}
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would wait %v before %s (max_jitter %v)\n", delay, task, max)
+		return nil
+	}
+
+	LogVerbose("Waiting %v before %s for %s (max_jitter %v)", delay, task, repoName, max)
+	if !sleepContext(ctx, delay) {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/lock"
+	"github.com/catflyflyfly/restic-helpers/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+// What a run does when another run of the same repository holds its lock
+const (
+	lockFail = "fail"
+	lockSkip = "skip"
+	lockWait = "wait"
+)
+
+var (
+	lockWaitFlag bool
+	lockSkipFlag bool
+	lockFailFlag bool
+)
+
+// addLockFlags adds --wait, --skip and --fail to a command that runs tasks on repositories
+func addLockFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&lockWaitFlag, "wait", false, "Wait for a run of the same repository that is in progress")
+	cmd.Flags().BoolVar(&lockSkipFlag, "skip", false, "Skip a repository that another run is using (default for scheduled runs)")
+	cmd.Flags().BoolVar(&lockFailFlag, "fail", false, "Fail on a repository that another run is using (default)")
+	cmd.MarkFlagsMutuallyExclusive("wait", "skip", "fail")
+}
+
+// lockMode returns the mode chosen with --wait, --skip or --fail. Scheduled
+// runs skip by default, so a slow backup does not pile up runs behind it.
+func lockMode(scheduled bool) string {
+	switch {
+	case lockWaitFlag:
+		return lockWait
+	case lockSkipFlag:
+		return lockSkip
+	case lockFailFlag:
+		return lockFail
+	case scheduled:
+		return lockSkip
+	default:
+		return lockFail
+	}
+}
+
+// withRunLock runs fn holding the run lock of a repository, so two runs never
+// use it at once, and handles a lock held by another run according to mode
+func withRunLock(ctx context.Context, repoName, task, mode string, fn func() error) error {
+	paths, err := config.GetPaths()
+	if err != nil {
+		return fmt.Errorf("failed to get paths: %w", err)
+	}
+	path := lock.Path(paths.StateDir, repoName)
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would lock %s (%s if another run holds it)\n", path, mode)
+		return fn()
+	}
+
+	l, err := lock.TryAcquire(path)
+	var held *lock.HeldError
+	if errors.As(err, &held) {
+		switch mode {
+		case lockSkip:
+			return skipLocked(repoName, task, held)
+		case lockWait:
+			fmt.Printf("Waiting for another run of %s to finish (%v)...\n", repoName, held)
+			l, err = lock.Acquire(ctx, path)
+		default:
+			return fmt.Errorf("another run of %s is in progress (%w); use --wait or --skip", repoName, held)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", repoName, err)
+	}
+	defer l.Release()
+
+	if l.StalePID != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: a previous run of %s (PID %d) exited without releasing its lock\n", repoName, l.StalePID)
+	}
+	return fn()
+}
+
+// skipLocked reports a run skipped because another run holds the lock, as a
+// healthchecks.io log event that leaves the check's state alone
+func skipLocked(repoName, task string, held *lock.HeldError) error {
+	message := fmt.Sprintf("Skipped %s of %s: another run is in progress (%v)", task, repoName, held)
+	fmt.Println(message)
+
+	cfg, repoCfg, err := loadConfigs(repoName)
+	if err != nil {
+		return err
+	}
+	notifier := notify.New(&cfg.Telegram, repoCfg.Healthcheck, IsDryRun(), IsVerbose())
+	if err := notifier.PingHealthcheckWithBody("log", message); err != nil {
+		LogVerbose("Warning: failed to ping healthcheck: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/restic"
+)
+
+// clearLine returns the cursor to the start of the line and erases it
+const clearLine = "\r\033[K"
+
+// newBackupOutput decodes restic backup --json, showing its progress on one
+// line when stdout is a terminal and, with --verbose, every file it saves.
+// The returned func clears the progress line once restic has exited.
+func newBackupOutput() (*restic.BackupOutput, func()) {
+	// restic's stdout and stderr are read by separate goroutines, which share
+	// the progress line
+	var mu sync.Mutex
+	shown := false
+	clear := func() {
+		if shown {
+			fmt.Print(clearLine)
+			shown = false
+		}
+	}
+	// locked runs f with the progress line cleared and the lock held
+	locked := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		clear()
+		f()
+	}
+
+	out := &restic.BackupOutput{
+		Text: writerFunc(func(p []byte) (n int, err error) {
+			locked(func() { n, err = os.Stdout.Write(p) })
+			return n, err
+		}),
+		// Errors start on a line of their own
+		ErrorText: writerFunc(func(p []byte) (n int, err error) {
+			locked(func() { n, err = os.Stderr.Write(p) })
+			return n, err
+		}),
+	}
+	if isTerminal(os.Stdout) {
+		out.OnStatus = func(s restic.BackupStatus) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Print(clearLine + formatProgress(s))
+			shown = true
+		}
+	}
+	if IsVerbose() {
+		out.OnVerbose = func(action, item string) {
+			locked(func() { fmt.Printf("%-10s %s\n", action, item) })
+		}
+	}
+	return out, func() { locked(func() {}) }
+}
+
+// writerFunc is an io.Writer that calls itself
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// formatProgress formats a progress message, e.g.
+// "[1m23s] 45.2%  1234 / 5678 files  1.000 GiB / 2.000 GiB  ETA 2m10s"
+func formatProgress(s restic.BackupStatus) string {
+	line := fmt.Sprintf("[%s] %5.1f%%  %d / %d files  %s / %s",
+		time.Duration(s.SecondsElapsed)*time.Second, s.PercentDone*100,
+		s.FilesDone, s.TotalFiles, restic.FormatBytes(s.BytesDone), restic.FormatBytes(s.TotalBytes))
+	if s.SecondsRemaining > 0 {
+		line += fmt.Sprintf("  ETA %s", time.Duration(s.SecondsRemaining)*time.Second)
+	}
+	if s.ErrorCount > 0 {
+		line += fmt.Sprintf("  %d errors", s.ErrorCount)
+	}
+	return line
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
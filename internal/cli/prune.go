@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/notify"
+	"github.com/catflyflyfly/restic-helpers/internal/retry"
+	"github.com/catflyflyfly/restic-helpers/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune <repo-name>",
+	Short: "Forget old snapshots and prune a repository",
+	Long: `Runs restic forget with the retention policy, then restic prune,
+regardless of prune.interval_days. Backups only prune when the interval has passed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPruneCmd,
+}
+
+func init() {
+	addLockFlags(pruneCmd)
+	rootCmd.AddCommand(pruneCmd)
+}
+
+func runPruneCmd(cmd *cobra.Command, args []string) error {
+	return withRunLock(cmd.Context(), args[0], "prune", lockMode(false), func() error {
+		return pruneRepo(cmd.Context(), args[0])
+	})
+}
+
+// pruneRepo forgets old snapshots and prunes a repository, with retries and notifications
+func pruneRepo(ctx context.Context, repoName string) error {
+	LogVerbose("Starting prune for repository: %s", repoName)
+
+	cfg, repoCfg, err := loadConfigs(repoName)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRequiredFiles(repoCfg.RequiredFiles()...); err != nil {
+		return err
+	}
+
+	notifier := notify.New(&cfg.Telegram, repoCfg.Healthcheck, IsDryRun(), IsVerbose())
+	policy := repoCfg.PrunePolicy(cfg.Prune)
+	forgetArgs := buildForgetArgs(repoCfg, policy)
+	pruneArgs := buildPruneArgs(repoCfg, policy)
+
+	if IsDryRun() {
+		fmt.Println("[dry-run] Forget command:")
+		fmt.Printf("restic %s\n", formatCmd(forgetArgs))
+		fmt.Println()
+		fmt.Println("[dry-run] Prune command:")
+		fmt.Printf("restic %s\n", formatCmd(pruneArgs))
+		notifier.PrintDryRunSummary()
+		return nil
+	}
+
+	env, err := repoCfg.ResticEnv()
+	if err != nil {
+		return err
+	}
+
+	if err := runForget(ctx, repoName, forgetArgs, env, cfg, notifier); err != nil {
+		return err
+	}
+	if err := runPrune(ctx, repoName, pruneArgs, env, cfg, notifier); err != nil {
+		return err
+	}
+
+	fmt.Printf("Prune completed successfully for %s\n", repoName)
+	return nil
+}
+
+// buildForgetArgs builds the forget command for the repository's retention policy
+func buildForgetArgs(repoCfg *config.RepoConfig, policy config.PruneConfig) []string {
+	if repoCfg.Prune != nil {
+		LogVerbose("Merging repository-specific prune config over the global one")
+	}
+	LogVerbose("Retention policy: %s", strings.Join(policy.ForgetArgs(), " "))
+
+	LogVerbose("Building forget command...")
+	forgetArgs := append([]string{"forget"}, repoCfg.RepoArgs()...)
+	forgetArgs = append(forgetArgs, policy.ForgetArgs()...)
+
+	if IsVerbose() {
+		forgetArgs = append(forgetArgs, "--verbose")
+	}
+
+	return forgetArgs
+}
+
+// buildPruneArgs builds the prune command with the repository's tuning
+func buildPruneArgs(repoCfg *config.RepoConfig, policy config.PruneConfig) []string {
+	LogVerbose("Building prune command...")
+	pruneArgs := append([]string{"prune"}, repoCfg.RepoArgs()...)
+	pruneArgs = append(pruneArgs, policy.PruneArgs()...)
+
+	if IsVerbose() {
+		pruneArgs = append(pruneArgs, "--verbose")
+	}
+
+	return pruneArgs
+}
+
+// pruneDue reports whether the last successful prune is older than the prune interval
+func pruneDue(repoName string, policy config.PruneConfig) (bool, error) {
+	paths, err := config.GetPaths()
+	if err != nil {
+		return false, fmt.Errorf("failed to get paths: %w", err)
+	}
+
+	s, err := state.Load(paths.StateDir, repoName)
+	if err != nil {
+		return false, err
+	}
+
+	return s.Due("prune", policy.PruneInterval(), time.Now()), nil
+}
+
+// runForget runs the forget command with retry and notifies on failure
+func runForget(ctx context.Context, repoName string, forgetArgs, env []string, cfg *config.Config, notifier *notify.Notifier) error {
+	LogVerbose("Forgetting old snapshots...")
+	LogVerbose("Executing: restic %s", strings.Join(forgetArgs, " "))
+	if err := retry.RunWithRetryContext(ctx, "forget", func() error { return runResticCommand(ctx, forgetArgs, env) }, cfg.Retry, LogVerbose); err != nil {
+		LogVerbose("Forget failed after retries, sending notifications...")
+		_ = notifier.SendTelegram(fmt.Sprintf("Forget failed for %s: %v", repoName, err))
+		return fmt.Errorf("forget failed: %w", err)
+	}
+	LogVerbose("Forget completed successfully")
+	return nil
+}
+
+// runPrune runs the prune command with retry and notifies on failure
+func runPrune(ctx context.Context, repoName string, pruneArgs, env []string, cfg *config.Config, notifier *notify.Notifier) error {
+	LogVerbose("Pruning unreferenced data...")
+	LogVerbose("Executing: restic %s", strings.Join(pruneArgs, " "))
+	if err := retry.RunWithRetryContext(ctx, "prune", func() error { return runResticCommand(ctx, pruneArgs, env) }, cfg.Retry, LogVerbose); err != nil {
+		LogVerbose("Prune failed after retries, sending notifications...")
+		_ = notifier.SendTelegram(fmt.Sprintf("Prune failed for %s: %v", repoName, err))
+		return fmt.Errorf("prune failed: %w", err)
+	}
+	LogVerbose("Prune completed successfully")
+	recordSuccess(repoName, "prune")
+	return nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/notify"
+	"github.com/catflyflyfly/restic-helpers/internal/retry"
+	"github.com/spf13/cobra"
+)
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate <repo-or-group>",
+	Short: "Copy snapshots to the repositories in replicate_to",
+	Long: `Runs restic copy from a repository into every repository in its replicate_to,
+e.g. from a local SFTP repository to B2. Snapshots already copied are skipped.
+
+Backups replicate on their own after they succeed; replicate is for manual runs.
+Each copy uses the target's retry settings, notifications and healthcheck.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runReplicate,
+}
+
+func init() {
+	addLockFlags(replicateCmd)
+	rootCmd.AddCommand(replicateCmd)
+}
+
+func runReplicate(cmd *cobra.Command, args []string) error {
+	return forEachRepo(args[0], func(repoName string) error {
+		return withRunLock(cmd.Context(), repoName, "replicate", lockMode(false), func() error {
+			repoCfg, err := config.LoadRepo(repoName)
+			if err != nil {
+				return fmt.Errorf("failed to load repository config: %w", err)
+			}
+			if len(repoCfg.ReplicateTo) == 0 {
+				return fmt.Errorf("%s has no replicate_to", repoName)
+			}
+			return replicate(cmd.Context(), repoCfg, lockMode(false))
+		})
+	})
+}
+
+// replicate copies the snapshots of a repository into every repository in
+// its replicate_to, taking each target's run lock with mode. A failing target
+// does not stop the others.
+func replicate(ctx context.Context, source *config.RepoConfig, mode string) error {
+	if cycle := config.ReplicationCycle(source); cycle != nil {
+		return fmt.Errorf("replicate_to forms a cycle (%s), which can deadlock runs waiting for each other's lock", strings.Join(cycle, " -> "))
+	}
+
+	var errs []error
+	for _, target := range source.ReplicateTo {
+		if err := replicateTo(ctx, source, target, mode); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// replicateTo runs restic copy from source into target holding the target's
+// run lock, which the caller holds for source
+func replicateTo(ctx context.Context, source *config.RepoConfig, target, mode string) error {
+	return withRunLock(ctx, target, "replicate", mode, func() error {
+		return copySnapshots(ctx, source, target)
+	})
+}
+
+// copySnapshots runs restic copy from source into target, with the target's
+// retries and notifications
+func copySnapshots(ctx context.Context, source *config.RepoConfig, target string) error {
+	LogVerbose("Replicating %s to %s", source.Name, target)
+
+	cfg, targetCfg, err := loadConfigs(target)
+	if err != nil {
+		return err
+	}
+	if err := checkRequiredFiles(append(source.RequiredFiles(), targetCfg.RequiredFiles()...)...); err != nil {
+		return err
+	}
+
+	notifier := notify.New(&cfg.Telegram, targetCfg.Healthcheck, IsDryRun(), IsVerbose())
+
+	// restic copy writes to the target and reads the source with --from-*
+	copyArgs := append([]string{"copy"}, targetCfg.RepoArgs()...)
+	copyArgs = append(copyArgs, source.FromRepoArgs()...)
+	if IsVerbose() {
+		copyArgs = append(copyArgs, "--verbose")
+	}
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Copy command (%s -> %s):\n", source.Name, target)
+		fmt.Printf("restic %s\n", formatCmd(copyArgs))
+		notifier.PrintDryRunSummary()
+		return nil
+	}
+
+	env, err := config.CopyEnv(source, targetCfg)
+	if err != nil {
+		return err
+	}
+
+	LogVerbose("Pinging healthcheck (start)...")
+	if err := notifier.PingHealthcheck("start"); err != nil {
+		LogVerbose("Warning: failed to ping healthcheck: %v", err)
+	}
+
+	LogVerbose("Executing: restic %s", strings.Join(copyArgs, " "))
+	err = retry.RunWithRetryContext(ctx, "replicate", func() error { return runResticCommand(ctx, copyArgs, env) }, cfg.Retry, LogVerbose)
+	if err != nil {
+		LogVerbose("Replication failed after retries, sending notifications...")
+		message := fmt.Sprintf("Replication of %s to %s failed: %v", source.Name, target, err)
+		_ = notifier.SendTelegram(message)
+		_ = notifier.PingHealthcheckWithBody("fail", message)
+		return fmt.Errorf("replication failed: %w", err)
+	}
+
+	LogVerbose("Pinging healthcheck (success)...")
+	if err := notifier.PingHealthcheck("success"); err != nil {
+		LogVerbose("Warning: failed to ping healthcheck: %v", err)
+	}
+
+	fmt.Printf("Replicated %s to %s\n", source.Name, target)
+	return nil
+}
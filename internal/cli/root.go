@@ -2,15 +2,19 @@ package cli
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/catflyflyfly/restic-helpers/internal/config"
 	"github.com/spf13/cobra"
 )
 
 const Version = "0.1.0"
 
 var (
-	dryRun  bool
-	verbose bool
+	dryRun    bool
+	verbose   bool
+	configDir string
+	lenient   bool
 )
 
 var rootCmd = &cobra.Command{
@@ -18,11 +22,28 @@ var rootCmd = &cobra.Command{
 	Short:   "Restic backup helper utilities",
 	Long:    `A CLI tool for managing restic backups with scheduling, notifications, and configuration management.`,
 	Version: Version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Through the environment, so that restic-helpers run by restic
+		// (e.g. secrets decrypt as a password command) sees it too
+		if configDir != "" {
+			if err := os.Setenv(config.ConfigDirEnv, configDir); err != nil {
+				return fmt.Errorf("failed to set %s: %w", config.ConfigDirEnv, err)
+			}
+		}
+		if lenient {
+			if err := os.Setenv(config.LenientEnv, "1"); err != nil {
+				return fmt.Errorf("failed to set %s: %w", config.LenientEnv, err)
+			}
+		}
+		return nil
+	},
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show commands without executing")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "Config directory (default $XDG_CONFIG_HOME/restic-helpers, env "+config.ConfigDirEnv+")")
+	rootCmd.PersistentFlags().BoolVar(&lenient, "lenient", false, "Warn about unknown keys in config files instead of failing (env "+config.LenientEnv+")")
 }
 
 func Execute() error {
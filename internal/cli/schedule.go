@@ -2,41 +2,100 @@ package cli
 
 import (
 	"fmt"
+	"maps"
 	"os"
-	"runtime"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/catflyflyfly/restic-helpers/internal/crontab"
 	"github.com/catflyflyfly/restic-helpers/internal/launchd"
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+	"github.com/catflyflyfly/restic-helpers/internal/systemd"
 	"github.com/spf13/cobra"
 )
 
+var (
+	scheduleBackend string
+	scheduleCatchUp bool
+	scheduleTask    string
+)
+
+// schedulerBackends maps --backend names to scheduler constructors
+var schedulerBackends = map[string]func() (scheduler.Scheduler, error){
+	"launchd": func() (scheduler.Scheduler, error) {
+		s, err := launchd.NewScheduler()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	},
+	"crontab": func() (scheduler.Scheduler, error) {
+		s, err := crontab.NewScheduler()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	},
+	"systemd": func() (scheduler.Scheduler, error) {
+		s, err := systemd.NewScheduler()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	},
+}
+
 var scheduleCmd = &cobra.Command{
-	Use:   "schedule <repo-name> <cron-expression>",
-	Short: "Schedule automated backups (macOS only)",
-	Long: `Creates a launchd job to run backups on a schedule.
+	Use:   "schedule <repo-or-group> <cron-expression>",
+	Short: "Schedule automated backups",
+	Long: `Creates a scheduled job to run backups on a schedule.
+
+The backend defaults to launchd on macOS and systemd on Linux. Use --task to
+schedule check or prune as separate jobs next to the backup. Given a group from
+[groups] in config.toml, one job is installed for every repository in it.
 
 Examples:
   restic-helpers schedule myrepo "0 2 * * *"     # Daily at 2 AM
-  restic-helpers schedule myrepo "0 */6 * * *"  # Every 6 hours`,
+  restic-helpers schedule myrepo "0 */6 * * *"  # Every 6 hours
+  restic-helpers schedule myrepo "0 2 * * *" --catch-up  # Run missed backups after wake or boot
+  restic-helpers schedule myrepo "0 5 * * 0" --task prune  # Prune weekly on its own
+  restic-helpers schedule nightly "0 2 * * *"   # Every repository in the nightly group
+  restic-helpers schedule preview "0 2 * * 1"   # Show the next fire times
+  restic-helpers schedule list                  # Show all scheduled jobs
+  restic-helpers schedule status myrepo         # Show one scheduled job`,
 	Args: cobra.ExactArgs(2),
 	RunE: runSchedule,
 }
 
 func init() {
+	scheduleCmd.Flags().IntVarP(&previewCount, "count", "n", 5, "Number of fire times to show with --dry-run")
+	scheduleCmd.Flags().BoolVar(&scheduleCatchUp, "catch-up", false, "Run a missed backup at login or boot, after the configured grace window")
+	scheduleCmd.Flags().StringVar(&scheduleTask, "task", scheduler.TaskBackup, "Task to schedule ("+strings.Join(scheduler.Tasks, ", ")+")")
+	scheduleCmd.PersistentFlags().StringVar(&scheduleBackend, "backend", "", "Scheduler backend ("+strings.Join(backendNames(), ", ")+")")
 	rootCmd.AddCommand(scheduleCmd)
 }
 
 func runSchedule(cmd *cobra.Command, args []string) error {
-	if runtime.GOOS != "darwin" {
-		return fmt.Errorf("scheduling is only supported on macOS")
-	}
-
-	repoName := args[0]
 	cronExpr := args[1]
 
-	LogVerbose("Loading repository config: %s", repoName)
-	if _, err := config.LoadRepo(repoName); err != nil {
-		return fmt.Errorf("failed to load repository config: %w", err)
+	if err := validateTask(scheduleTask); err != nil {
+		return err
+	}
+	if scheduleCatchUp && scheduleTask != scheduler.TaskBackup {
+		return fmt.Errorf("--catch-up only applies to backup")
+	}
+	if IsDryRun() {
+		if err := validatePreviewCount(); err != nil {
+			return err
+		}
+	}
+
+	sched, err := newScheduler()
+	if err != nil {
+		return err
 	}
 
 	LogVerbose("Getting executable path")
@@ -47,35 +106,156 @@ func runSchedule(cmd *cobra.Command, args []string) error {
 	LogVerbose("Binary path: %s", binaryPath)
 
 	LogVerbose("Parsing cron expression: %s", cronExpr)
-	job, err := launchd.CreateJob(repoName, cronExpr, binaryPath)
+	if scheduleCatchUp {
+		schedule, err := cron.Parse(cronExpr)
+		if err != nil {
+			return fmt.Errorf("invalid cron expression: %w", err)
+		}
+		// An interval has no fixed fire time that could be missed
+		if schedule.Every > 0 {
+			return fmt.Errorf("--catch-up needs a calendar schedule, not %q", cronExpr)
+		}
+	}
+
+	err = forEachRepo(args[0], func(repoName string) error {
+		return scheduleRepo(sched, repoName, cronExpr, binaryPath)
+	})
+	if err != nil || !IsDryRun() {
+		return err
+	}
+
+	fmt.Printf("[dry-run] Next %d runs:\n", previewCount)
+	return printNextRuns(cronExpr, previewCount)
+}
+
+// scheduleRepo installs the job for one repository
+func scheduleRepo(sched scheduler.Scheduler, repoName, cronExpr, binaryPath string) error {
+	cfg, repoCfg, err := loadConfigs(repoName)
 	if err != nil {
-		return fmt.Errorf("failed to create launchd job: %w", err)
+		return err
+	}
+	if err := checkScheduledSecrets(cfg, repoCfg, sched.Name()); err != nil {
+		return err
 	}
-	LogVerbose("Created %d calendar intervals", len(job.StartCalendarInterval))
 
-	plistPath, _ := launchd.GetPlistPath(repoName)
+	// The env table stays out of the job, whose files other processes can
+	// read; the job loads it from the repository config when it runs
+	env := make(map[string]string)
+	paths, err := config.GetPaths()
+	if err != nil {
+		return fmt.Errorf("failed to get paths: %w", err)
+	}
+	// The job must find the same config and state directories as this shell
+	for _, key := range config.DirEnvVars {
+		if value := os.Getenv(key); value != "" {
+			env[key] = value
+		}
+	}
+	if _, ok := env[config.ConfigDirEnv]; ok {
+		env[config.ConfigDirEnv] = paths.ConfigDir
+	}
+
+	job, err := sched.Create(scheduler.Spec{
+		Repo:     repoName,
+		Schedule: cronExpr,
+		Binary:   binaryPath,
+		Task:     scheduleTask,
+		CatchUp:  scheduleCatchUp,
+		Env:      env,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create %s job: %w", sched.Name(), err)
+	}
+	LogVerbose("%s", job.Summary)
 
 	if IsDryRun() {
-		plistContent, err := launchd.EncodePlist(job)
-		if err != nil {
-			return fmt.Errorf("failed to encode plist: %w", err)
+		for _, f := range job.Files {
+			fmt.Printf("[dry-run] Would create %s at %s\n\n", f.Kind, f.Path)
+			fmt.Println(f.Content)
 		}
-		fmt.Printf("[dry-run] Would create launchd job at %s\n\n", plistPath)
-		fmt.Println(plistContent)
 		return nil
 	}
 
+	// Jobs log to the state directory, which schedulers do not create
+	if err := os.MkdirAll(paths.StateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
 	LogVerbose("Uninstalling existing job if present")
-	_ = launchd.Uninstall(repoName)
+	_ = sched.Uninstall(job.Spec.Name())
 
-	LogVerbose("Installing launchd job")
-	if err := launchd.Install(job, repoName); err != nil {
-		return fmt.Errorf("failed to install launchd job: %w", err)
+	LogVerbose("Installing %s job", sched.Name())
+	if err := sched.Install(job); err != nil {
+		return fmt.Errorf("failed to install %s job: %w", sched.Name(), err)
 	}
+	recordScheduled(repoName, scheduleTask, false)
 
-	fmt.Printf("Scheduled backup for %s\n", repoName)
+	fmt.Printf("Scheduled %s for %s\n", scheduleTask, repoName)
 	fmt.Printf("  Schedule: %s\n", cronExpr)
-	fmt.Printf("  Plist: %s\n", plistPath)
+	if scheduleCatchUp {
+		fmt.Println("  Catch-up: enabled")
+	}
+	for _, f := range job.Files {
+		fmt.Printf("  %s: %s\n", f.Kind, f.Path)
+	}
+
+	return nil
+}
+
+// newScheduler returns the scheduler selected by --backend, or the OS default
+func newScheduler() (scheduler.Scheduler, error) {
+	name := scheduleBackend
+	if name == "" {
+		name = scheduler.DefaultBackend()
+	}
+
+	factory, ok := schedulerBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduler backend %q (available: %s)", name, strings.Join(backendNames(), ", "))
+	}
+
+	LogVerbose("Using scheduler backend: %s", name)
+	return factory()
+}
+
+// validateTask returns an error unless task can be scheduled
+func validateTask(task string) error {
+	if !slices.Contains(scheduler.Tasks, task) {
+		return fmt.Errorf("unknown task %q (available: %s)", task, strings.Join(scheduler.Tasks, ", "))
+	}
+	return nil
+}
+
+// backendNames returns the sorted names of all scheduler backends
+func backendNames() []string {
+	names := make([]string, 0, len(schedulerBackends))
+	for name := range schedulerBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkScheduledSecrets rejects secrets read from an env var. Jobs start from
+// the scheduler's environment, not the current shell, and secrets are never
+// written into the job, so the variable would be unset when the job runs.
+func checkScheduledSecrets(cfg *config.Config, repoCfg *config.RepoConfig, backend string) error {
+	type source struct {
+		name   string
+		secret config.Secret
+	}
+	secrets := []source{{"password", repoCfg.Password}}
+	if cfg.Telegram.Enabled {
+		secrets = append(secrets, source{"telegram bot_token", cfg.Telegram.BotToken})
+	}
+	for _, key := range slices.Sorted(maps.Keys(repoCfg.Environment)) {
+		secrets = append(secrets, source{"env " + key, repoCfg.Environment[key]})
+	}
 
+	for _, s := range secrets {
+		if s.secret.Env != "" {
+			return fmt.Errorf("the %s of %s is read from $%s, which a %s job cannot see: use a file or command source, or run `restic-helpers daemon` from a shell that sets it", s.name, repoCfg.Name, s.secret.Env, backend)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+	"github.com/spf13/cobra"
+)
+
+var scheduleJSON bool
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all scheduled jobs",
+	Long:  `Lists every restic-helpers job installed in the scheduler backend.`,
+	Args:  cobra.NoArgs,
+	RunE:  runScheduleList,
+}
+
+func init() {
+	scheduleListCmd.Flags().BoolVar(&scheduleJSON, "json", false, "Output as JSON")
+	scheduleCmd.AddCommand(scheduleListCmd)
+}
+
+func runScheduleList(cmd *cobra.Command, args []string) error {
+	sched, err := newScheduler()
+	if err != nil {
+		return err
+	}
+
+	LogVerbose("Listing %s jobs", sched.Name())
+	entries, err := sched.List()
+	if err != nil {
+		return fmt.Errorf("failed to list %s jobs: %w", sched.Name(), err)
+	}
+
+	if scheduleJSON {
+		return printJSON(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No scheduled jobs found (%s)\n", sched.Name())
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tTASK\tBACKEND\tSCHEDULE\tLOADED\tLAST EXIT\tLOG")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Repo, e.Task, e.Backend, e.Schedule, formatLoaded(e), formatExitStatus(e), e.StdoutPath)
+	}
+	return w.Flush()
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func formatLoaded(e scheduler.Entry) string {
+	if e.Loaded {
+		return "yes"
+	}
+	return "no"
+}
+
+func formatExitStatus(e scheduler.Entry) string {
+	if e.LastExitStatus == nil {
+		return "-"
+	}
+	return fmt.Sprint(*e.LastExitStatus)
+}
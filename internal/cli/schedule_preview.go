@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/spf13/cobra"
+)
+
+const previewTimeFormat = "Mon 2006-01-02 15:04 MST"
+
+var previewCount int
+
+var schedulePreviewCmd = &cobra.Command{
+	Use:   "preview <cron-expression>",
+	Short: "Show the next fire times of a cron expression",
+	Long: `Prints the next fire times of a cron expression in local time, without installing anything.
+
+Example:
+  restic-helpers schedule preview "0 2 * * 1"   # Mondays at 2 AM`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSchedulePreview,
+}
+
+func init() {
+	schedulePreviewCmd.Flags().IntVarP(&previewCount, "count", "n", 5, "Number of fire times to show")
+	scheduleCmd.AddCommand(schedulePreviewCmd)
+}
+
+func runSchedulePreview(cmd *cobra.Command, args []string) error {
+	cronExpr := args[0]
+	if err := validatePreviewCount(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Next %d runs of %q:\n", previewCount, cronExpr)
+	return printNextRuns(cronExpr, previewCount)
+}
+
+// validatePreviewCount rejects a --count below 1 before anything is printed
+func validatePreviewCount() error {
+	if previewCount < 1 {
+		return fmt.Errorf("--count must be at least 1, got %d", previewCount)
+	}
+	return nil
+}
+
+// printNextRuns prints the next n fire times of a cron expression
+func printNextRuns(cronExpr string, n int) error {
+	runs, err := cron.NextRuns(cronExpr, time.Now(), n)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		fmt.Printf("  %s\n", run.Local().Format(previewTimeFormat))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+	"github.com/spf13/cobra"
+)
+
+var scheduleStatusCmd = &cobra.Command{
+	Use:   "status <repo-name>",
+	Short: "Show the scheduled job for a repository",
+	Long:  `Shows the schedule, log paths and last exit status of a repository's scheduled job (see --task).`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runScheduleStatus,
+}
+
+func init() {
+	scheduleStatusCmd.Flags().BoolVar(&scheduleJSON, "json", false, "Output as JSON")
+	scheduleStatusCmd.Flags().StringVar(&scheduleTask, "task", scheduler.TaskBackup, "Scheduled task ("+strings.Join(scheduler.Tasks, ", ")+")")
+	scheduleCmd.AddCommand(scheduleStatusCmd)
+}
+
+func runScheduleStatus(cmd *cobra.Command, args []string) error {
+	repoName := args[0]
+	if err := validateTask(scheduleTask); err != nil {
+		return err
+	}
+
+	sched, err := newScheduler()
+	if err != nil {
+		return err
+	}
+
+	LogVerbose("Getting %s %s job for: %s", sched.Name(), scheduleTask, repoName)
+	entry, err := sched.Status(scheduler.JobName(repoName, scheduleTask))
+	if errors.Is(err, scheduler.ErrNotScheduled) {
+		return fmt.Errorf("no scheduled %s job found for %s", scheduleTask, repoName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s job: %w", sched.Name(), err)
+	}
+
+	if scheduleJSON {
+		return printJSON(entry)
+	}
+
+	fmt.Printf("Repository: %s\n", entry.Repo)
+	fmt.Printf("  Task: %s\n", entry.Task)
+	fmt.Printf("  Backend: %s\n", entry.Backend)
+	fmt.Printf("  Schedule: %s\n", entry.Schedule)
+	fmt.Printf("  Loaded: %s\n", formatLoaded(*entry))
+	fmt.Printf("  Last exit status: %s\n", formatExitStatus(*entry))
+	fmt.Printf("  Stdout log: %s\n", entry.StdoutPath)
+	fmt.Printf("  Stderr log: %s\n", entry.StderrPath)
+	for _, f := range entry.Files {
+		fmt.Printf("  %s: %s\n", f.Kind, f.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Encrypt, decrypt and edit age-encrypted secret files",
+	Long: `Manages age-encrypted secret files such as secret.toml.age and
+repos/<name>/password.txt.age, which are preferred over their plaintext
+versions when present.
+
+Files are encrypted to the age identity set with [age] identity in config.toml
+or X_RESTIC_AGE_IDENTITY (default: age.key in the config directory). encrypt
+creates the identity if it does not exist yet.
+
+Examples:
+  restic-helpers secrets encrypt ~/.config/restic-helpers/secret.toml
+  restic-helpers secrets edit ~/.config/restic-helpers/secret.toml.age
+  restic-helpers secrets decrypt ~/.config/restic-helpers/repos/myrepo/password.txt.age`,
+}
+
+var secretsEncryptCmd = &cobra.Command{
+	Use:   "encrypt <file>",
+	Short: "Encrypt a file to <file>.age",
+	Long:  `Encrypts a plaintext file to <file>.age. The plaintext file is left in place.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSecretsEncrypt,
+}
+
+var secretsDecryptCmd = &cobra.Command{
+	Use:   "decrypt <file.age>",
+	Short: "Print a decrypted file",
+	Long:  `Decrypts an age-encrypted file to standard output, e.g. for restic --password-command.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSecretsDecrypt,
+}
+
+var secretsEditCmd = &cobra.Command{
+	Use:   "edit <file.age>",
+	Short: "Edit an encrypted file in $EDITOR",
+	Long: `Decrypts a file to a private temporary file, opens it in $VISUAL or $EDITOR
+(default: vi), and encrypts it again if it changed. A missing file is created.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSecretsEdit,
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsEncryptCmd, secretsDecryptCmd, secretsEditCmd)
+	rootCmd.AddCommand(secretsCmd)
+}
+
+func runSecretsEncrypt(cmd *cobra.Command, args []string) error {
+	plainFile := args[0]
+	encryptedFile := plainFile + secrets.Ext
+
+	if secrets.IsEncrypted(plainFile) {
+		return fmt.Errorf("%s is already encrypted", plainFile)
+	}
+
+	identity, err := config.IdentityPath()
+	if err != nil {
+		return fmt.Errorf("failed to get age identity: %w", err)
+	}
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would encrypt %s to %s with identity %s\n", plainFile, encryptedFile, identity)
+		return nil
+	}
+
+	plaintext, err := os.ReadFile(plainFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", plainFile, err)
+	}
+
+	if err := ensureIdentity(identity); err != nil {
+		return err
+	}
+
+	LogVerbose("Encrypting %s with identity %s", plainFile, identity)
+	if err := secrets.EncryptFile(encryptedFile, plaintext, identity); err != nil {
+		return err
+	}
+
+	fmt.Printf("Encrypted %s to %s\n", plainFile, encryptedFile)
+	fmt.Printf("Check it with 'restic-helpers secrets decrypt %s', then delete %s\n", encryptedFile, plainFile)
+	return nil
+}
+
+func runSecretsDecrypt(cmd *cobra.Command, args []string) error {
+	encryptedFile := args[0]
+
+	identity, err := config.IdentityPath()
+	if err != nil {
+		return fmt.Errorf("failed to get age identity: %w", err)
+	}
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would decrypt %s with identity %s\n", encryptedFile, identity)
+		return nil
+	}
+
+	plaintext, err := secrets.DecryptFile(encryptedFile, identity)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(plaintext)
+	return err
+}
+
+func runSecretsEdit(cmd *cobra.Command, args []string) error {
+	encryptedFile := args[0]
+	if !secrets.IsEncrypted(encryptedFile) {
+		return fmt.Errorf("%s does not end in %s", encryptedFile, secrets.Ext)
+	}
+
+	identity, err := config.IdentityPath()
+	if err != nil {
+		return fmt.Errorf("failed to get age identity: %w", err)
+	}
+
+	editor := secretsEditor()
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would edit %s in %s with identity %s\n", encryptedFile, editor, identity)
+		return nil
+	}
+
+	var plaintext []byte
+	if _, err := os.Stat(encryptedFile); err == nil {
+		if plaintext, err = secrets.DecryptFile(encryptedFile, identity); err != nil {
+			return err
+		}
+	} else if err := ensureIdentity(identity); err != nil {
+		return err
+	}
+
+	// Keep the plaintext in a private directory, named like the file for syntax highlighting
+	tmpDir, err := os.MkdirTemp("", config.AppName+"-secrets-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, strings.TrimSuffix(filepath.Base(encryptedFile), secrets.Ext))
+	if err := os.WriteFile(tmpFile, plaintext, 0600); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	LogVerbose("Opening %s in %s", encryptedFile, editor)
+	editCmd := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", tmpFile)
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	if err := editCmd.Run(); err != nil {
+		return fmt.Errorf("editor failed, %s left unchanged: %w", encryptedFile, err)
+	}
+
+	edited, err := os.ReadFile(tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to read temp file: %w", err)
+	}
+	if _, err := os.Stat(encryptedFile); err == nil && bytes.Equal(edited, plaintext) {
+		fmt.Printf("No changes to %s\n", encryptedFile)
+		return nil
+	}
+
+	if err := secrets.EncryptFile(encryptedFile, edited, identity); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %s\n", encryptedFile)
+	return nil
+}
+
+// ensureIdentity creates the age identity file if it does not exist yet
+func ensureIdentity(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	id, err := secrets.GenerateIdentity(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created age identity %s (public key %s)\n", path, id.Recipient())
+	fmt.Println("Back it up: secrets encrypted with it cannot be recovered without it")
+	return nil
+}
+
+// secretsEditor returns the editor command from $VISUAL or $EDITOR
+func secretsEditor() string {
+	for _, key := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(key); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
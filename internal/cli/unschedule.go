@@ -1,59 +1,73 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"runtime"
+	"strings"
 
-	"github.com/catflyflyfly/restic-helpers/internal/launchd"
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
 	"github.com/spf13/cobra"
 )
 
 var unscheduleCmd = &cobra.Command{
-	Use:   "unschedule <repo-name>",
+	Use:   "unschedule <repo-or-group>",
 	Short: "Remove scheduled backups",
-	Long:  `Removes the launchd job for the specified repository.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runUnschedule,
+	Long: `Removes the scheduled job for the specified repository, or for every
+repository in a group (see --task).`,
+	Args: cobra.ExactArgs(1),
+	RunE: runUnschedule,
 }
 
 func init() {
+	unscheduleCmd.Flags().StringVar(&scheduleBackend, "backend", "", "Scheduler backend ("+strings.Join(backendNames(), ", ")+")")
+	unscheduleCmd.Flags().StringVar(&scheduleTask, "task", scheduler.TaskBackup, "Scheduled task ("+strings.Join(scheduler.Tasks, ", ")+")")
 	rootCmd.AddCommand(unscheduleCmd)
 }
 
 func runUnschedule(cmd *cobra.Command, args []string) error {
-	if runtime.GOOS != "darwin" {
-		return fmt.Errorf("scheduling is only supported on macOS")
+	if err := validateTask(scheduleTask); err != nil {
+		return err
 	}
 
-	repoName := args[0]
-
-	LogVerbose("Getting plist path for: %s", repoName)
-	plistPath, err := launchd.GetPlistPath(repoName)
+	sched, err := newScheduler()
 	if err != nil {
-		return fmt.Errorf("failed to get plist path: %w", err)
+		return err
 	}
-	LogVerbose("Plist path: %s", plistPath)
 
-	LogVerbose("Checking if plist exists")
-	if _, err := os.Stat(plistPath); os.IsNotExist(err) {
-		return fmt.Errorf("no scheduled job found for %s", repoName)
+	return forEachRepo(args[0], func(repoName string) error {
+		return unscheduleRepo(sched, repoName)
+	})
+}
+
+// unscheduleRepo removes the job of one repository
+func unscheduleRepo(sched scheduler.Scheduler, repoName string) error {
+	name := scheduler.JobName(repoName, scheduleTask)
+
+	LogVerbose("Checking if %s job exists for: %s", scheduleTask, repoName)
+	entry, err := sched.Status(name)
+	if errors.Is(err, scheduler.ErrNotScheduled) {
+		return fmt.Errorf("no scheduled %s job found for %s", scheduleTask, repoName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s job: %w", sched.Name(), err)
+	}
+	for _, f := range entry.Files {
+		LogVerbose("  %s: %s", f.Kind, f.Path)
 	}
 
 	if IsDryRun() {
-		fmt.Printf("[dry-run] Would remove launchd job at %s\n\n", plistPath)
-		content, err := os.ReadFile(plistPath)
-		if err == nil {
-			fmt.Println(string(content))
+		for _, f := range entry.Files {
+			fmt.Printf("[dry-run] Would remove %s at %s\n\n", f.Kind, f.Path)
+			fmt.Println(f.Content)
 		}
 		return nil
 	}
 
-	LogVerbose("Unloading launchd job")
-	if err := launchd.Uninstall(repoName); err != nil {
-		return fmt.Errorf("failed to uninstall launchd job: %w", err)
+	LogVerbose("Removing %s job", sched.Name())
+	if err := sched.Uninstall(name); err != nil {
+		return fmt.Errorf("failed to uninstall %s job: %w", sched.Name(), err)
 	}
 
-	fmt.Printf("Unscheduled backup for %s\n", repoName)
+	fmt.Printf("Unscheduled %s for %s\n", scheduleTask, repoName)
 	return nil
 }
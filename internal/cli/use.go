@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/catflyflyfly/restic-helpers/internal/config"
 	"github.com/spf13/cobra"
@@ -35,22 +36,29 @@ func runUse(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get paths: %w", err)
 	}
 
-	repoDir := filepath.Join(paths.ReposDir, repoName)
-
-	// Check if repository exists
-	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
-		return fmt.Errorf("repository %q does not exist", repoName)
+	repoCfg, err := config.LoadRepo(repoName)
+	if err != nil {
+		return fmt.Errorf("failed to load repository config: %w", err)
 	}
 
-	nameFile := filepath.Join(repoDir, "name.txt")
-	passwordFile := filepath.Join(repoDir, "password.txt")
 	envFile := filepath.Join(paths.ConfigDir, "env.sh")
 
 	envContent := fmt.Sprintf(`# This file is auto-generated by 'restic-helpers use' command.
 # Source this file to use restic with %s
-export RESTIC_REPOSITORY_FILE="%s"
-export RESTIC_PASSWORD_FILE="%s"
-`, repoName, nameFile, passwordFile)
+`, repoName)
+	// Keep restic-helpers run from the env (e.g. secrets decrypt) on this config
+	if os.Getenv(config.ConfigDirEnv) != "" {
+		envContent += fmt.Sprintf("export %s=\"%s\"\n", config.ConfigDirEnv, paths.ConfigDir)
+	}
+	// Share restic's cache with backups run by restic-helpers
+	if os.Getenv(resticCacheDirEnv) == "" {
+		envContent += fmt.Sprintf("export %s=\"%s\"\n", resticCacheDirEnv, paths.CacheDir)
+	}
+	// Env values are escaped for double quotes, leaving secret references to expand when sourced
+	for _, kv := range repoCfg.Env() {
+		key, value, _ := strings.Cut(kv, "=")
+		envContent += fmt.Sprintf("export %s=\"%s\"\n", key, value)
+	}
 
 	if IsDryRun() {
 		fmt.Printf("[dry-run] Would write to %s:\n%s", envFile, envContent)
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+)
+
+// whenWindow is how late a --when run may start after the fire time it is for.
+// launchd starts jobs late after sleep and runs missed ones once on wake.
+const whenWindow = time.Hour
+
+// whenFile records the last fire time a --when run started for
+func whenFile(stateDir, repoName string) string {
+	return filepath.Join(stateDir, repoName+".when")
+}
+
+// whenDue reports whether a --when run should start now: expr fired within
+// whenWindow and no run started for that fire time yet. The fire time is
+// recorded first, so the extra runs of a gated trigger skip it.
+func whenDue(repoName, expr string, now time.Time) (bool, error) {
+	fire, ok, err := cron.LastFire(expr, now, whenWindow)
+	if err != nil {
+		return false, fmt.Errorf("invalid --when expression: %w", err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	paths, err := config.GetPaths()
+	if err != nil {
+		return false, fmt.Errorf("failed to get paths: %w", err)
+	}
+	path := whenFile(paths.StateDir, repoName)
+
+	if data, err := os.ReadFile(path); err == nil {
+		last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err == nil && !last.Before(fire) {
+			LogVerbose("Backup for %s already started for %s", repoName, fire.Format(time.RFC3339))
+			return false, nil
+		}
+	}
+
+	if IsDryRun() {
+		fmt.Printf("[dry-run] Would record fire time %s in %s\n", fire.Format(time.RFC3339), path)
+		return true, nil
+	}
+	// Failing to record only risks a repeated run, so it does not stop this one
+	if err := os.WriteFile(path, []byte(fire.Format(time.RFC3339)+"\n"), 0600); err != nil {
+		LogVerbose("Warning: failed to record fire time for %s: %v", repoName, err)
+	}
+	return true, nil
+}
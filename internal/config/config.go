@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/catflyflyfly/restic-helpers/internal/retry"
+	"github.com/catflyflyfly/restic-helpers/internal/secrets"
 )
 
 const (
@@ -21,21 +24,87 @@ const (
 type Paths struct {
 	ConfigDir string
 	StateDir  string
+	CacheDir  string
 	ReposDir  string
 }
 
+// ConfigDirEnv overrides the config directory, like the --config-dir flag
+const ConfigDirEnv = EnvPrefix + "CONFIG_DIR"
+
+// DirEnvVars are the environment variables GetPaths reads, which scheduled
+// jobs need to resolve the same directories
+var DirEnvVars = []string{ConfigDirEnv, "XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME"}
+
 // TelegramConfig holds Telegram notification settings
 type TelegramConfig struct {
 	Enabled  bool   `toml:"enabled" json:"enabled"`
-	BotToken string `toml:"bot_token" json:"bot_token,omitempty"`
+	BotToken Secret `toml:"bot_token" json:"bot_token,omitzero"`
 	ChatID   string `toml:"chat_id" json:"chat_id,omitempty"`
 }
 
-// PruneConfig holds snapshot retention settings
+// PruneConfig holds snapshot retention settings, mirroring restic forget's policy
+// flags, and when and how to prune. Zero values are left out of the commands.
 type PruneConfig struct {
+	KeepLast    int `toml:"keep_last" json:"keep_last,omitempty"`
+	KeepHourly  int `toml:"keep_hourly" json:"keep_hourly,omitempty"`
 	KeepDaily   int `toml:"keep_daily" json:"keep_daily"`
 	KeepWeekly  int `toml:"keep_weekly" json:"keep_weekly"`
 	KeepMonthly int `toml:"keep_monthly" json:"keep_monthly"`
+	KeepYearly  int `toml:"keep_yearly" json:"keep_yearly,omitempty"`
+
+	// Durations in restic's format, e.g. "1y6m" or "14d"
+	KeepWithin        string `toml:"keep_within" json:"keep_within,omitempty"`
+	KeepWithinHourly  string `toml:"keep_within_hourly" json:"keep_within_hourly,omitempty"`
+	KeepWithinDaily   string `toml:"keep_within_daily" json:"keep_within_daily,omitempty"`
+	KeepWithinWeekly  string `toml:"keep_within_weekly" json:"keep_within_weekly,omitempty"`
+	KeepWithinMonthly string `toml:"keep_within_monthly" json:"keep_within_monthly,omitempty"`
+	KeepWithinYearly  string `toml:"keep_within_yearly" json:"keep_within_yearly,omitempty"`
+
+	KeepTag []string `toml:"keep_tag" json:"keep_tag,omitempty"`
+
+	// GroupBy, Host and Tags select the snapshots the policy applies to
+	GroupBy string   `toml:"group_by" json:"group_by,omitempty"`
+	Host    []string `toml:"host" json:"host,omitempty"`
+	Tags    []string `toml:"tags" json:"tags,omitempty"`
+
+	// IntervalDays is how often backup follows forget with a prune; 0 prunes after every backup
+	IntervalDays int `toml:"interval_days" json:"interval_days"`
+	// MaxUnused and MaxRepackSize are passed to restic prune, e.g. "5%" or "2G"
+	MaxUnused     string `toml:"max_unused" json:"max_unused,omitempty"`
+	MaxRepackSize string `toml:"max_repack_size" json:"max_repack_size,omitempty"`
+}
+
+// ScheduleConfig holds per-repository schedules used by the daemon
+type ScheduleConfig struct {
+	Backup string `toml:"backup" json:"backup,omitempty"`
+	Check  string `toml:"check" json:"check,omitempty"`
+	Prune  string `toml:"prune" json:"prune,omitempty"`
+	// MaxJitter is the longest random delay (in seconds) before a scheduled backup or check
+	MaxJitter int `toml:"max_jitter" json:"max_jitter,omitempty"`
+}
+
+// Values of partial_snapshot
+const (
+	PartialFail = "fail"
+	PartialWarn = "warn"
+)
+
+// CatchUpConfig holds settings for catching up missed scheduled runs
+type CatchUpConfig struct {
+	// Grace is how long to wait (in seconds) after startup or wake before a catch-up run
+	Grace int `toml:"grace" json:"grace"`
+}
+
+// ParallelConfig holds settings for backing up several repositories at once
+type ParallelConfig struct {
+	// Jobs is how many repositories backup --all and group backups run at once
+	Jobs int `toml:"jobs" json:"jobs"`
+}
+
+// AgeConfig holds settings for age-encrypted secret files
+type AgeConfig struct {
+	// Identity is the age identity file; relative paths resolve from the config directory
+	Identity string `toml:"identity" json:"identity,omitempty"`
 }
 
 // RetryConfig is an alias for retry.Config
@@ -46,17 +115,42 @@ type Config struct {
 	Telegram TelegramConfig `toml:"telegram" json:"telegram"`
 	Prune    PruneConfig    `toml:"prune" json:"prune"`
 	Retry    RetryConfig    `toml:"retry" json:"retry"`
+	CatchUp  CatchUpConfig  `toml:"catch_up" json:"catch_up"`
+	Parallel ParallelConfig `toml:"parallel" json:"parallel"`
+	Age      AgeConfig      `toml:"age" json:"age"`
+	// Groups name lists of repositories, e.g. nightly = ["laptop", "photos"]
+	Groups map[string][]string `toml:"groups" json:"groups,omitempty"`
 }
 
 // RepoConfig holds per-repository configuration
 type RepoConfig struct {
-	Name         string       `json:"name"`
-	RepoFile     string       `json:"repo_file"`
-	PasswordFile string       `json:"password_file"`
-	PathsFile    string       `json:"paths_file"`
-	ExcludeFile  string       `json:"exclude_file,omitempty"`
-	Healthcheck  string       `json:"healthcheck,omitempty"`
-	Prune        *PruneConfig `json:"prune,omitempty"`
+	Name        string          `json:"name"`
+	Extends     string          `json:"extends,omitempty"`
+	Repository  string          `json:"repository,omitempty"`
+	RepoFile    string          `json:"repo_file,omitempty"`
+	Password    Secret          `json:"password"`
+	Paths       []string        `json:"paths,omitempty"`
+	PathsFile   string          `json:"paths_file,omitempty"`
+	Excludes    []string        `json:"exclude,omitempty"`
+	ExcludeFile string          `json:"exclude_file,omitempty"`
+	Healthcheck string          `json:"healthcheck,omitempty"`
+	Prune       *PruneConfig    `json:"prune,omitempty"`
+	Retry       *RetryConfig    `json:"retry,omitempty"`
+	Telegram    *TelegramConfig `json:"telegram,omitempty"`
+	Schedule    *ScheduleConfig `json:"schedule,omitempty"`
+	// Environment is set for every restic command, e.g. B2_ACCOUNT_KEY
+	Environment map[string]Secret `json:"env,omitempty"`
+	// PartialSnapshot is how a backup that saved a snapshot without some
+	// unreadable files counts: PartialFail (the default) or PartialWarn
+	PartialSnapshot string `json:"partial_snapshot,omitempty"`
+	// ReplicateTo names the repositories that successful backups are copied to
+	ReplicateTo []string `json:"replicate_to,omitempty"`
+	// Sources lists where the config was read from, lowest precedence first
+	Sources []string `json:"sources,omitempty"`
+
+	// overrides are the keys set for Prune, Retry and Telegram, e.g.
+	// "prune.keep_daily", used to merge them over the global config
+	overrides map[string]bool
 }
 
 // DefaultConfig returns the default configuration
@@ -66,30 +160,59 @@ func DefaultConfig() *Config {
 			Enabled: true,
 		},
 		Prune: PruneConfig{
-			KeepDaily:   7,
-			KeepWeekly:  4,
-			KeepMonthly: 6,
+			KeepDaily:    7,
+			KeepWeekly:   4,
+			KeepMonthly:  6,
+			IntervalDays: 7,
 		},
 		Retry: retry.DefaultConfig(),
+		CatchUp: CatchUpConfig{
+			Grace: 300,
+		},
+		Parallel: ParallelConfig{
+			Jobs: 2,
+		},
 	}
 }
 
-// GetPaths returns the standard application paths
+// GetPaths returns the standard application paths. The config directory is
+// X_RESTIC_CONFIG_DIR if set; it and the state and cache directories
+// otherwise follow the XDG base directory spec, defaulting to ~/.config,
+// ~/.local/state and ~/.cache.
 func GetPaths() (*Paths, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, err
 	}
 
-	configDir := filepath.Join(homeDir, ".config", AppName)
+	configDir := filepath.Join(xdgDir("XDG_CONFIG_HOME", homeDir, ".config"), AppName)
+	if dir := os.Getenv(ConfigDirEnv); dir != "" {
+		configDir, err = filepath.Abs(expandHome(dir))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ConfigDirEnv, err)
+		}
+	}
+	stateDir := filepath.Join(xdgDir("XDG_STATE_HOME", homeDir, ".local", "state"), AppName)
+	cacheDir := filepath.Join(xdgDir("XDG_CACHE_HOME", homeDir, ".cache"), AppName)
 	reposDir := filepath.Join(configDir, "repos")
 
 	return &Paths{
 		ConfigDir: configDir,
+		StateDir:  stateDir,
+		CacheDir:  cacheDir,
 		ReposDir:  reposDir,
 	}, nil
 }
 
+// xdgDir returns the XDG base directory in envKey, or the default under the
+// home directory. Relative paths are invalid per the spec and ignored.
+func xdgDir(envKey, homeDir string, fallback ...string) string {
+	if dir := os.Getenv(envKey); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{homeDir}, fallback...)...)
+}
+
 // Load loads the configuration from files and environment
 func Load() (*Config, error) {
 	return LoadWithVerbose(false)
@@ -110,15 +233,30 @@ func LoadWithVerbose(verbose bool) (*Config, error) {
 		return cfg, fmt.Errorf("failed to load config.toml: %w", err)
 	}
 
-	// Override with secret.toml
+	// Override with secret.toml, preferring secret.toml.age when present
 	secretFile := filepath.Join(paths.ConfigDir, "secret.toml")
-	if err := loadTOMLFile(secretFile, cfg); err != nil && !os.IsNotExist(err) {
+	if _, err := os.Stat(secretFile + secrets.Ext); err == nil {
+		data, err := decryptFile(secretFile + secrets.Ext)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to load secret.toml.age: %w", err)
+		}
+		md, err := toml.Decode(string(data), cfg)
+		if err == nil {
+			err = checkConfigKeys(secretFile+secrets.Ext, md)
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("failed to load secret.toml.age: %w", err)
+		}
+	} else if err := loadTOMLFile(secretFile, cfg); err != nil && !os.IsNotExist(err) {
 		return cfg, fmt.Errorf("failed to load secret.toml: %w", err)
 	}
 
 	// Override with environment variables
 	applyEnvOverrides(cfg)
 
+	// A bot_token file in secret.toml is relative to the config directory
+	cfg.Telegram.BotToken = cfg.Telegram.BotToken.withBaseDir(paths.ConfigDir)
+
 	if verbose {
 		cfg.PrettyPrint()
 	}
@@ -128,25 +266,20 @@ func LoadWithVerbose(verbose bool) (*Config, error) {
 
 // PrettyPrint prints the config as formatted JSON (hides sensitive values)
 func (c *Config) PrettyPrint() {
-	// Create a copy with masked sensitive values
-	masked := *c
-	if masked.Telegram.BotToken != "" {
-		masked.Telegram.BotToken = "***"
-	}
-
-	data, err := json.MarshalIndent(masked, "", "  ")
+	// Secrets marshal as their source, with inline values masked
+	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
-		fmt.Printf("Config: %+v\n", masked)
+		fmt.Println("Config: failed to format")
 		return
 	}
 	fmt.Printf("Config loaded:\n%s\n", string(data))
 }
 
-// PrettyPrint prints the repo config as formatted JSON
+// PrettyPrint prints the repo config as formatted JSON (hides sensitive values)
 func (r *RepoConfig) PrettyPrint() {
 	data, err := json.MarshalIndent(r, "", "  ")
 	if err != nil {
-		fmt.Printf("RepoConfig: %+v\n", r)
+		fmt.Println("RepoConfig: failed to format")
 		return
 	}
 	fmt.Printf("Repository config:\n%s\n", string(data))
@@ -158,8 +291,20 @@ func loadTOMLFile(path string, cfg *Config) error {
 		return err
 	}
 
-	_, err := toml.DecodeFile(path, cfg)
-	return err
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return err
+	}
+	return checkConfigKeys(path, md)
+}
+
+// checkConfigKeys checks config.toml or secret.toml for unknown keys, leaving
+// the [repos] and [profiles] tables to LoadRepo
+func checkConfigKeys(file string, md toml.MetaData) error {
+	keys := slices.DeleteFunc(unknownKeys(md), func(key string) bool {
+		return strings.HasPrefix(key, "repos.") || strings.HasPrefix(key, "profiles.")
+	})
+	return checkUnknownKeys(file, keys)
 }
 
 // applyEnvOverrides applies environment variable overrides to the config
@@ -167,11 +312,14 @@ func applyEnvOverrides(cfg *Config) {
 	applyEnvOverridesTelegramConfig(&cfg.Telegram)
 	applyEnvOverridesRetryConfig(&cfg.Retry)
 	applyEnvOverridesPruneConfig(&cfg.Prune)
+	applyEnvOverridesCatchUpConfig(&cfg.CatchUp)
+	setEnvInt(&cfg.Parallel.Jobs, EnvPrefix+"PARALLEL_JOBS")
+	setEnvString(&cfg.Age.Identity, EnvPrefix+"AGE_IDENTITY")
 }
 
 func applyEnvOverridesTelegramConfig(cfg *TelegramConfig) {
 	setEnvBool(&cfg.Enabled, EnvPrefix+"TELEGRAM_ENABLED")
-	setEnvString(&cfg.BotToken, EnvPrefix+"TELEGRAM_BOT_TOKEN")
+	setEnvSecret(&cfg.BotToken, EnvPrefix+"TELEGRAM_BOT_TOKEN")
 	setEnvString(&cfg.ChatID, EnvPrefix+"TELEGRAM_CHAT_ID")
 }
 
@@ -184,9 +332,29 @@ func applyEnvOverridesRetryConfig(cfg *RetryConfig) {
 }
 
 func applyEnvOverridesPruneConfig(cfg *PruneConfig) {
+	setEnvInt(&cfg.KeepLast, EnvPrefix+"PRUNE_KEEP_LAST")
+	setEnvInt(&cfg.KeepHourly, EnvPrefix+"PRUNE_KEEP_HOURLY")
 	setEnvInt(&cfg.KeepDaily, EnvPrefix+"PRUNE_KEEP_DAILY")
 	setEnvInt(&cfg.KeepWeekly, EnvPrefix+"PRUNE_KEEP_WEEKLY")
 	setEnvInt(&cfg.KeepMonthly, EnvPrefix+"PRUNE_KEEP_MONTHLY")
+	setEnvInt(&cfg.KeepYearly, EnvPrefix+"PRUNE_KEEP_YEARLY")
+	setEnvString(&cfg.KeepWithin, EnvPrefix+"PRUNE_KEEP_WITHIN")
+	setEnvString(&cfg.KeepWithinHourly, EnvPrefix+"PRUNE_KEEP_WITHIN_HOURLY")
+	setEnvString(&cfg.KeepWithinDaily, EnvPrefix+"PRUNE_KEEP_WITHIN_DAILY")
+	setEnvString(&cfg.KeepWithinWeekly, EnvPrefix+"PRUNE_KEEP_WITHIN_WEEKLY")
+	setEnvString(&cfg.KeepWithinMonthly, EnvPrefix+"PRUNE_KEEP_WITHIN_MONTHLY")
+	setEnvString(&cfg.KeepWithinYearly, EnvPrefix+"PRUNE_KEEP_WITHIN_YEARLY")
+	setEnvStrings(&cfg.KeepTag, EnvPrefix+"PRUNE_KEEP_TAG")
+	setEnvString(&cfg.GroupBy, EnvPrefix+"PRUNE_GROUP_BY")
+	setEnvStrings(&cfg.Host, EnvPrefix+"PRUNE_HOST")
+	setEnvStrings(&cfg.Tags, EnvPrefix+"PRUNE_TAGS")
+	setEnvInt(&cfg.IntervalDays, EnvPrefix+"PRUNE_INTERVAL_DAYS")
+	setEnvString(&cfg.MaxUnused, EnvPrefix+"PRUNE_MAX_UNUSED")
+	setEnvString(&cfg.MaxRepackSize, EnvPrefix+"PRUNE_MAX_REPACK_SIZE")
+}
+
+func applyEnvOverridesCatchUpConfig(cfg *CatchUpConfig) {
+	setEnvInt(&cfg.Grace, EnvPrefix+"CATCH_UP_GRACE")
 }
 
 // setEnvString sets a string value from environment variable if present
@@ -196,6 +364,26 @@ func setEnvString(target *string, envKey string) {
 	}
 }
 
+// setEnvSecret sets an inline secret from environment variable if present
+func setEnvSecret(target *Secret, envKey string) {
+	if value := os.Getenv(envKey); value != "" {
+		*target = Secret{Value: value}
+	}
+}
+
+// setEnvStrings sets a string slice from a comma-separated environment variable if present
+func setEnvStrings(target *[]string, envKey string) {
+	if value := os.Getenv(envKey); value != "" {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*target = values
+	}
+}
+
 // setEnvInt sets an int value from environment variable if present
 func setEnvInt(target *int, envKey string) {
 	if value := os.Getenv(envKey); value != "" {
@@ -213,7 +401,9 @@ func setEnvBool(target *bool, envKey string) {
 	}
 }
 
-// LoadRepo loads a repository configuration
+// LoadRepo loads a repository configuration. Each setting comes from the
+// first of these that sets it: repos/<name>/repo.toml, the [repos.<name>]
+// table in config.toml, then the txt and toml files in repos/<name>/.
 func LoadRepo(name string) (*RepoConfig, error) {
 	paths, err := GetPaths()
 	if err != nil {
@@ -222,21 +412,72 @@ func LoadRepo(name string) (*RepoConfig, error) {
 
 	repoDir := filepath.Join(paths.ReposDir, name)
 
+	table, err := loadRepoTable(filepath.Join(paths.ConfigDir, "config.toml"), name)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if repository exists
-	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
+	_, statErr := os.Stat(repoDir)
+	if os.IsNotExist(statErr) && table == nil {
 		return nil, fmt.Errorf("repository %q does not exist", name)
 	}
 
+	var file *repoSource
+	repoFile := filepath.Join(repoDir, "repo.toml")
+	if _, err := os.Stat(repoFile); err == nil {
+		if file, err = loadRepoFile(repoFile); err != nil {
+			return nil, err
+		}
+	}
+
 	repo := &RepoConfig{
-		Name:         name,
-		RepoFile:     filepath.Join(repoDir, "name.txt"),
-		PasswordFile: filepath.Join(repoDir, "password.txt"),
-		PathsFile:    filepath.Join(repoDir, "paths.txt"),
+		Name:      name,
+		RepoFile:  filepath.Join(repoDir, "name.txt"),
+		Password:  Secret{File: filepath.Join(repoDir, "password.txt")},
+		PathsFile: filepath.Join(repoDir, "paths.txt"),
+		overrides: make(map[string]bool),
+	}
+
+	// The profile is named by the highest precedence source and is the base
+	// that every file of the repo overrides
+	for _, source := range []*repoSource{table, file} {
+		if source != nil && source.defined("extends") {
+			repo.Extends = source.values.Extends
+		}
+	}
+	if repo.Extends != "" {
+		if err := repo.applyProfile(filepath.Join(paths.ConfigDir, "config.toml"), repo.Extends, nil); err != nil {
+			return nil, err
+		}
+	}
+	if statErr == nil {
+		repo.Sources = append(repo.Sources, repoDir)
+	}
+
+	// The txt files replace the profile's keys when they exist
+	if _, err := os.Stat(filepath.Join(repoDir, "name.txt")); err == nil {
+		repo.Repository = ""
+		repo.RepoFile = filepath.Join(repoDir, "name.txt")
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "paths.txt")); err == nil {
+		repo.Paths = nil
+		repo.PathsFile = filepath.Join(repoDir, "paths.txt")
+	}
+
+	// Prefer an encrypted password.txt.age
+	passwordFile := filepath.Join(repoDir, "password.txt")
+	for _, path := range []string{passwordFile + secrets.Ext, passwordFile} {
+		if _, err := os.Stat(path); err == nil {
+			repo.Password = Secret{File: path}
+			break
+		}
 	}
 
 	// Set exclude file if it exists
 	excludeFile := filepath.Join(repoDir, "exclude.txt")
 	if _, err := os.Stat(excludeFile); err == nil {
+		repo.Excludes = nil
 		repo.ExcludeFile = excludeFile
 	}
 
@@ -250,11 +491,95 @@ func LoadRepo(name string) (*RepoConfig, error) {
 	pruneFile := filepath.Join(repoDir, "prune.toml")
 	if _, err := os.Stat(pruneFile); err == nil {
 		var pruneConfig PruneConfig
-		if _, err := toml.DecodeFile(pruneFile, &pruneConfig); err != nil {
+		md, err := toml.DecodeFile(pruneFile, &pruneConfig)
+		if err == nil {
+			err = checkUnknownKeys(pruneFile, unknownKeys(md))
+		}
+		if err != nil {
 			return nil, fmt.Errorf("failed to load prune.toml: %w", err)
 		}
-		repo.Prune = &pruneConfig
+		// prune.toml holds the [prune] keys at the top level
+		defined := func(key ...string) bool { return md.IsDefined(key[1:]...) }
+		overlayDefined(&repo.Prune, &pruneConfig, "prune", defined, repo.overrides)
+	}
+
+	// Load per-repo schedule config
+	scheduleFile := filepath.Join(repoDir, "schedule.toml")
+	if _, err := os.Stat(scheduleFile); err == nil {
+		var scheduleConfig ScheduleConfig
+		md, err := toml.DecodeFile(scheduleFile, &scheduleConfig)
+		if err == nil {
+			err = checkUnknownKeys(scheduleFile, unknownKeys(md))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load schedule.toml: %w", err)
+		}
+		repo.Schedule = &scheduleConfig
+	}
+
+	// Apply the single-file sources, lowest precedence first
+	for _, source := range []*repoSource{table, file} {
+		if source == nil {
+			continue
+		}
+		if err := repo.apply(source); err != nil {
+			return nil, err
+		}
 	}
 
 	return repo, nil
 }
+
+// ResolveGroup returns the repositories of a group, or the name itself if it is not a group
+func (c *Config) ResolveGroup(name string) ([]string, error) {
+	members, ok := c.Groups[name]
+	if !ok {
+		return []string{name}, nil
+	}
+
+	repos, err := ListRepos()
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(repos, name) {
+		return nil, fmt.Errorf("%q is both a repository and a group", name)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("group %q has no repositories", name)
+	}
+	return members, nil
+}
+
+// ListRepos returns the names of all configured repositories
+func ListRepos() ([]string, error) {
+	paths, err := GetPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(paths.ReposDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	// Repositories defined only in config.toml have no directory
+	tables, err := repoTableNames(filepath.Join(paths.ConfigDir, "config.toml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range tables {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -28,6 +30,10 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.Retry.MaxAttempts != 5 {
 		t.Errorf("expected MaxAttempts=5, got %d", cfg.Retry.MaxAttempts)
 	}
+
+	if cfg.Parallel.Jobs != 2 {
+		t.Errorf("expected Parallel.Jobs=2, got %d", cfg.Parallel.Jobs)
+	}
 }
 
 func TestEnvOverrides(t *testing.T) {
@@ -49,8 +55,8 @@ func TestEnvOverrides(t *testing.T) {
 		t.Error("expected Telegram.Enabled to be false after env override")
 	}
 
-	if cfg.Telegram.BotToken != "test-token" {
-		t.Errorf("expected BotToken='test-token', got %q", cfg.Telegram.BotToken)
+	if cfg.Telegram.BotToken.Value != "test-token" {
+		t.Errorf("expected BotToken='test-token', got %q", cfg.Telegram.BotToken.Value)
 	}
 
 	if cfg.Prune.KeepDaily != 14 {
@@ -81,10 +87,7 @@ func TestLoadRepo(t *testing.T) {
 		}
 	}
 
-	// Override home dir for test
-	origHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", origHome)
+	setHome(t, tmpDir)
 
 	repo, err := LoadRepo("testrepo")
 	if err != nil {
@@ -101,8 +104,8 @@ func TestLoadRepo(t *testing.T) {
 	}
 
 	expectedPasswordFile := filepath.Join(repoDir, "password.txt")
-	if repo.PasswordFile != expectedPasswordFile {
-		t.Errorf("expected PasswordFile=%q, got %q", expectedPasswordFile, repo.PasswordFile)
+	if repo.Password.File != expectedPasswordFile {
+		t.Errorf("expected Password.File=%q, got %q", expectedPasswordFile, repo.Password.File)
 	}
 
 	expectedPathsFile := filepath.Join(repoDir, "paths.txt")
@@ -119,3 +122,606 @@ func TestLoadRepo(t *testing.T) {
 		t.Errorf("expected Healthcheck='https://hc-ping.com/abc123', got %q", repo.Healthcheck)
 	}
 }
+
+func TestLoadRepoSchedule(t *testing.T) {
+	tmpDir := t.TempDir()
+	reposDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos")
+	for _, name := range []string{"laptop", "photos"} {
+		if err := os.MkdirAll(filepath.Join(reposDir, name), 0700); err != nil {
+			t.Fatalf("failed to create repo dir: %v", err)
+		}
+	}
+
+	schedule := "backup = \"0 2 * * *\"\nprune = \"@weekly\"\n"
+	if err := os.WriteFile(filepath.Join(reposDir, "laptop", "schedule.toml"), []byte(schedule), 0600); err != nil {
+		t.Fatalf("failed to write schedule.toml: %v", err)
+	}
+
+	setHome(t, tmpDir)
+
+	repos, err := ListRepos()
+	if err != nil {
+		t.Fatalf("ListRepos failed: %v", err)
+	}
+	if len(repos) != 2 || repos[0] != "laptop" || repos[1] != "photos" {
+		t.Errorf("expected repos [laptop photos], got %v", repos)
+	}
+
+	repo, err := LoadRepo("laptop")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+	if repo.Schedule == nil {
+		t.Fatal("expected Schedule to be loaded from schedule.toml")
+	}
+	if repo.Schedule.Backup != "0 2 * * *" || repo.Schedule.Check != "" || repo.Schedule.Prune != "@weekly" {
+		t.Errorf("unexpected schedule: %+v", repo.Schedule)
+	}
+
+	repo, err = LoadRepo("photos")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+	if repo.Schedule != nil {
+		t.Errorf("expected no schedule for photos, got %+v", repo.Schedule)
+	}
+}
+
+func TestLoadRepoPruneMerge(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos", "devbox")
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+
+	prune := "keep_hourly = 24\nkeep_daily = 3\nkeep_tag = [\"keep\"]\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "prune.toml"), []byte(prune), 0600); err != nil {
+		t.Fatalf("failed to write prune.toml: %v", err)
+	}
+
+	setHome(t, tmpDir)
+
+	repo, err := LoadRepo("devbox")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+
+	global := DefaultConfig().Prune
+	global.KeepYearly = 2
+	global.Host = []string{"devbox"}
+
+	policy := repo.PrunePolicy(global)
+	want := []string{
+		"--keep-hourly=24",
+		"--keep-daily=3",
+		"--keep-weekly=4",
+		"--keep-monthly=6",
+		"--keep-yearly=2",
+		"--keep-tag=keep",
+		"--host=devbox",
+	}
+	if got := policy.ForgetArgs(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ForgetArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestPruneArgs(t *testing.T) {
+	policy := PruneConfig{
+		KeepLast:         3,
+		KeepDaily:        -1,
+		KeepWithin:       "1y6m",
+		KeepWithinHourly: "2d",
+		GroupBy:          "host,paths",
+		Tags:             []string{"daily", "system"},
+	}
+
+	want := []string{
+		"--keep-last=3",
+		"--keep-daily=-1",
+		"--keep-within=1y6m",
+		"--keep-within-hourly=2d",
+		"--group-by=host,paths",
+		"--tag=daily",
+		"--tag=system",
+	}
+	if got := policy.ForgetArgs(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ForgetArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestEnvOverridesPruneLists(t *testing.T) {
+	cfg := DefaultConfig()
+
+	t.Setenv("X_RESTIC_PRUNE_KEEP_TAG", "keep, important")
+	t.Setenv("X_RESTIC_PRUNE_KEEP_WITHIN", "30d")
+
+	applyEnvOverrides(cfg)
+
+	if strings.Join(cfg.Prune.KeepTag, ",") != "keep,important" {
+		t.Errorf("expected KeepTag=[keep important], got %q", cfg.Prune.KeepTag)
+	}
+	if cfg.Prune.KeepWithin != "30d" {
+		t.Errorf("expected KeepWithin='30d', got %q", cfg.Prune.KeepWithin)
+	}
+}
+
+func TestPruneTuning(t *testing.T) {
+	policy := DefaultConfig().Prune
+	if policy.PruneInterval() != 7*24*time.Hour {
+		t.Errorf("expected a weekly prune interval by default, got %v", policy.PruneInterval())
+	}
+
+	policy.MaxUnused = "5%"
+	policy.MaxRepackSize = "2G"
+	want := []string{"--max-unused=5%", "--max-repack-size=2G"}
+	if got := policy.PruneArgs(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("PruneArgs() = %q, want %q", got, want)
+	}
+	for _, arg := range policy.ForgetArgs() {
+		if strings.HasPrefix(arg, "--max-") {
+			t.Errorf("ForgetArgs() contains prune flag %q", arg)
+		}
+	}
+}
+
+func TestLoadRepoPrecedence(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".config", "restic-helpers")
+	repoDir := filepath.Join(configDir, "repos", "laptop")
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+
+	files := map[string]string{
+		filepath.Join(repoDir, "healthcheck.txt"): "https://hc-ping.com/txt",
+		filepath.Join(repoDir, "exclude.txt"):     "*.tmp",
+		filepath.Join(repoDir, "prune.toml"):      "keep_daily = 3\nkeep_weekly = 2\n",
+		filepath.Join(repoDir, "repo.toml"): `repository = "sftp:nas:/laptop"
+paths = ["~/Documents", "/etc"]
+
+[prune]
+keep_daily = 14
+
+[retry]
+max_attempts = 2
+`,
+		filepath.Join(configDir, "config.toml"): `[repos.laptop]
+repository = "sftp:old:/laptop"
+healthcheck = "https://hc-ping.com/table"
+password_file = "laptop.pass"
+
+[repos.laptop.prune]
+keep_weekly = 8
+keep_monthly = 12
+
+[repos.cloud]
+repository = "b2:bucket:/cloud"
+paths = ["/srv"]
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	setHome(t, tmpDir)
+
+	repo, err := LoadRepo("laptop")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+
+	// repo.toml wins over config.toml, which wins over the txt files
+	if repo.Repository != "sftp:nas:/laptop" || repo.RepoFile != "" {
+		t.Errorf("expected repository from repo.toml, got %q (file %q)", repo.Repository, repo.RepoFile)
+	}
+	if repo.Healthcheck != "https://hc-ping.com/table" {
+		t.Errorf("expected healthcheck from config.toml, got %q", repo.Healthcheck)
+	}
+	if repo.Password.File != filepath.Join(configDir, "laptop.pass") {
+		t.Errorf("expected password file relative to config.toml, got %q", repo.Password.File)
+	}
+	if repo.ExcludeFile != filepath.Join(repoDir, "exclude.txt") {
+		t.Errorf("expected exclude.txt to be kept, got %q", repo.ExcludeFile)
+	}
+	if repo.PathsFile != "" || strings.Join(repo.Paths, ",") != filepath.Join(tmpDir, "Documents")+",/etc" {
+		t.Errorf("expected inline paths, got %q (file %q)", repo.Paths, repo.PathsFile)
+	}
+
+	policy := repo.PrunePolicy(DefaultConfig().Prune)
+	if policy.KeepDaily != 14 || policy.KeepWeekly != 8 || policy.KeepMonthly != 12 {
+		t.Errorf("expected prune merged per key, got %+v", policy)
+	}
+	if retry := repo.RetryPolicy(DefaultConfig().Retry); retry.MaxAttempts != 2 || retry.BackoffMax != DefaultConfig().Retry.BackoffMax {
+		t.Errorf("expected retry merged per key, got %+v", retry)
+	}
+
+	want := []string{"--repo=sftp:nas:/laptop", "--password-file=" + repo.Password.File}
+	if got := repo.RepoArgs(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("RepoArgs() = %q, want %q", got, want)
+	}
+
+	repos, err := ListRepos()
+	if err != nil {
+		t.Fatalf("ListRepos failed: %v", err)
+	}
+	if strings.Join(repos, ",") != "cloud,laptop" {
+		t.Errorf("expected repos [cloud laptop], got %v", repos)
+	}
+
+	cloud, err := LoadRepo("cloud")
+	if err != nil {
+		t.Fatalf("LoadRepo for a config.toml-only repo failed: %v", err)
+	}
+	if got := cloud.PathArgs(); strings.Join(got, " ") != "-- /srv" {
+		t.Errorf("PathArgs() = %q, want [-- /srv]", got)
+	}
+}
+
+func TestLoadRepoProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".config", "restic-helpers")
+	repoDir := filepath.Join(configDir, "repos", "photos")
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+
+	files := map[string]string{
+		filepath.Join(configDir, "config.toml"): `[profiles.base]
+exclude = ["*.tmp"]
+
+[profiles.base.prune]
+keep_daily = 7
+keep_weekly = 4
+
+[profiles.base.retry]
+max_attempts = 5
+
+[profiles.base-b2]
+extends = "base"
+password = { file = "b2.pass" }
+
+[profiles.base-b2.prune]
+keep_weekly = 8
+
+[profiles.base-b2.env]
+B2_ACCOUNT_ID = "shared-id"
+B2_ACCOUNT_KEY = { env = "B2_KEY" }
+
+[profiles.base-b2.telegram]
+chat_id = "42"
+
+[repos.photos]
+extends = "base-b2"
+
+[repos.loop]
+extends = "a"
+
+[profiles.a]
+extends = "b"
+
+[profiles.b]
+extends = "a"
+`,
+		filepath.Join(repoDir, "repo.toml"): `repository = "b2:bucket:/photos"
+paths = ["/srv/photos"]
+
+[prune]
+keep_daily = 30
+
+[env]
+B2_ACCOUNT_ID = "photos-id"
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	setHome(t, tmpDir)
+
+	repo, err := LoadRepo("photos")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+
+	if repo.Extends != "base-b2" {
+		t.Errorf("Extends = %q, want base-b2", repo.Extends)
+	}
+	if strings.Join(repo.Excludes, ",") != "*.tmp" {
+		t.Errorf("expected excludes from the base profile, got %q", repo.Excludes)
+	}
+	if repo.Password.File != filepath.Join(configDir, "b2.pass") {
+		t.Errorf("expected password file relative to config.toml, got %q", repo.Password.File)
+	}
+
+	// Sections merge per key along the chain, the repo winning
+	policy := repo.PrunePolicy(DefaultConfig().Prune)
+	if policy.KeepDaily != 30 || policy.KeepWeekly != 8 || policy.KeepMonthly != DefaultConfig().Prune.KeepMonthly {
+		t.Errorf("expected prune merged along the chain, got %+v", policy)
+	}
+	if retry := repo.RetryPolicy(DefaultConfig().Retry); retry.MaxAttempts != 5 {
+		t.Errorf("expected retry from the base profile, got %+v", retry)
+	}
+	if settings := repo.TelegramSettings(DefaultConfig().Telegram); settings.ChatID != "42" {
+		t.Errorf("expected chat_id from the profile, got %q", settings.ChatID)
+	}
+	if repo.Environment["B2_ACCOUNT_ID"].Value != "photos-id" || repo.Environment["B2_ACCOUNT_KEY"].Env != "B2_KEY" {
+		t.Errorf("expected env merged per variable, got %v", repo.Environment)
+	}
+
+	wantSources := []string{
+		filepath.Join(configDir, "config.toml") + " [profiles.base]",
+		filepath.Join(configDir, "config.toml") + " [profiles.base-b2]",
+		repoDir,
+		filepath.Join(configDir, "config.toml") + " [repos.photos]",
+		filepath.Join(repoDir, "repo.toml"),
+	}
+	if strings.Join(repo.Sources, "\n") != strings.Join(wantSources, "\n") {
+		t.Errorf("Sources = %q, want %q", repo.Sources, wantSources)
+	}
+
+	// The repo's own files override the profile too
+	if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(`repository = "b2:bucket:/photos"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "prune.toml"), []byte("keep_weekly = 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "exclude.txt"), []byte("*.bak\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err = LoadRepo("photos")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+	if policy := repo.PrunePolicy(DefaultConfig().Prune); policy.KeepWeekly != 2 || policy.KeepDaily != 7 {
+		t.Errorf("expected prune.toml over the profile, got %+v", policy)
+	}
+	if repo.Excludes != nil || repo.ExcludeFile != filepath.Join(repoDir, "exclude.txt") {
+		t.Errorf("expected exclude.txt over the profile, got %q, %q", repo.Excludes, repo.ExcludeFile)
+	}
+
+	// repo.toml can drop the profile named in config.toml
+	if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(`extends = ""`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if repo, err := LoadRepo("photos"); err != nil || repo.Excludes != nil {
+		t.Errorf("expected no profile, got %+v, %v", repo, err)
+	}
+
+	if _, err := LoadRepo("loop"); err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(`extends = "missing"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRepo("photos"); err == nil {
+		t.Error("expected a missing profile to fail")
+	}
+}
+
+func TestLoadRepoPartialSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos", "laptop")
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	setHome(t, tmpDir)
+
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{`"warn"`, false},
+		{`"fail"`, false},
+		{`"ignore"`, true},
+	}
+	for _, tt := range tests {
+		content := "repository = \"/srv\"\npartial_snapshot = " + tt.value + "\n"
+		if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadRepo("laptop")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("partial_snapshot = %s: error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if err == nil && `"`+cfg.PartialSnapshot+`"` != tt.value {
+			t.Errorf("PartialSnapshot = %q, want %s", cfg.PartialSnapshot, tt.value)
+		}
+	}
+}
+
+func TestLoadRepoReplicateTo(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos", "laptop")
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	setHome(t, tmpDir)
+	t.Setenv("LAPTOP_PASSWORD", "hunter2")
+
+	content := `repository = "sftp:nas:/laptop"
+password = { env = "LAPTOP_PASSWORD" }
+replicate_to = ["offsite"]
+
+[env]
+SFTP_USER = "backup"
+`
+	if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := LoadRepo("laptop")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+	if strings.Join(repo.ReplicateTo, ",") != "offsite" {
+		t.Errorf("ReplicateTo = %q", repo.ReplicateTo)
+	}
+	if got := strings.Join(repo.FromRepoArgs(), " "); got != "--from-repo=sftp:nas:/laptop" {
+		t.Errorf("FromRepoArgs() = %q", got)
+	}
+	env, err := repo.FromResticEnv()
+	if err != nil || strings.Join(env, " ") != "SFTP_USER=backup RESTIC_FROM_PASSWORD=hunter2" {
+		t.Errorf("FromResticEnv() = %q, %v", env, err)
+	}
+
+	// The target can share a backend variable, but not set it differently
+	target := &RepoConfig{Name: "offsite", Environment: map[string]Secret{"SFTP_USER": {Value: "backup"}}}
+	env, err = CopyEnv(repo, target)
+	if err != nil || strings.Join(env, " ") != "SFTP_USER=backup RESTIC_FROM_PASSWORD=hunter2 SFTP_USER=backup" {
+		t.Errorf("CopyEnv() = %q, %v", env, err)
+	}
+	target.Environment["SFTP_USER"] = Secret{Value: "offsite"}
+	if _, err := CopyEnv(repo, target); err == nil || !strings.Contains(err.Error(), "SFTP_USER") {
+		t.Errorf("expected SFTP_USER to conflict, got %v", err)
+	}
+
+	content = "repository = \"/srv\"\nreplicate_to = [\"laptop\"]\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRepo("laptop"); err == nil {
+		t.Error("expected replicate_to listing the repository itself to be rejected")
+	}
+}
+
+func TestResolveGroup(t *testing.T) {
+	tmpDir := t.TempDir()
+	reposDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos")
+	for _, name := range []string{"laptop", "photos", "both"} {
+		if err := os.MkdirAll(filepath.Join(reposDir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setHome(t, tmpDir)
+
+	cfg := DefaultConfig()
+	cfg.Groups = map[string][]string{
+		"nightly": {"laptop", "photos"},
+		"both":    {"laptop"},
+		"empty":   {},
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"nightly", "laptop,photos", false},
+		{"laptop", "laptop", false},
+		{"both", "", true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		got, err := cfg.ResolveGroup(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveGroup(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("ResolveGroup(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetPathsXDG(t *testing.T) {
+	home := t.TempDir()
+	setHome(t, home)
+
+	paths, err := GetPaths()
+	if err != nil {
+		t.Fatalf("GetPaths failed: %v", err)
+	}
+	want := Paths{
+		ConfigDir: filepath.Join(home, ".config", "restic-helpers"),
+		StateDir:  filepath.Join(home, ".local", "state", "restic-helpers"),
+		CacheDir:  filepath.Join(home, ".cache", "restic-helpers"),
+		ReposDir:  filepath.Join(home, ".config", "restic-helpers", "repos"),
+	}
+	if *paths != want {
+		t.Errorf("GetPaths() = %+v, want %+v", *paths, want)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+	t.Setenv("XDG_CACHE_HOME", "relative/is/ignored")
+	paths, err = GetPaths()
+	if err != nil {
+		t.Fatalf("GetPaths failed: %v", err)
+	}
+	want = Paths{
+		ConfigDir: "/xdg/config/restic-helpers",
+		StateDir:  "/xdg/state/restic-helpers",
+		CacheDir:  filepath.Join(home, ".cache", "restic-helpers"),
+		ReposDir:  "/xdg/config/restic-helpers/repos",
+	}
+	if *paths != want {
+		t.Errorf("GetPaths() = %+v, want %+v", *paths, want)
+	}
+
+	t.Setenv("X_RESTIC_CONFIG_DIR", "~/work-backups")
+	paths, err = GetPaths()
+	if err != nil {
+		t.Fatalf("GetPaths failed: %v", err)
+	}
+	if paths.ConfigDir != filepath.Join(home, "work-backups") || paths.ReposDir != filepath.Join(home, "work-backups", "repos") {
+		t.Errorf("expected X_RESTIC_CONFIG_DIR to win, got %+v", *paths)
+	}
+}
+
+func TestReplicationCycle(t *testing.T) {
+	tmpDir := t.TempDir()
+	setHome(t, tmpDir)
+	graph := map[string]string{
+		"laptop":  `["offsite"]`,
+		"offsite": `["laptop"]`,
+		"a":       `["b", "missing"]`,
+		"b":       `["c"]`,
+		"c":       `["a"]`,
+		"photos":  `["a", "offsite"]`,
+	}
+	for name, targets := range graph {
+		repoDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos", name)
+		if err := os.MkdirAll(repoDir, 0700); err != nil {
+			t.Fatalf("failed to create repo dir: %v", err)
+		}
+		content := "repository = \"/srv/" + name + "\"\nreplicate_to = " + targets + "\n"
+		if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		repo string
+		want string
+	}{
+		{"laptop", "laptop offsite laptop"},
+		{"a", "a b c a"},
+		{"c", "c a b c"},
+		{"photos", ""}, // replicates into cycles, but is on none
+	}
+	for _, tt := range tests {
+		repo, err := LoadRepo(tt.repo)
+		if err != nil {
+			t.Fatalf("LoadRepo(%s) failed: %v", tt.repo, err)
+		}
+		if got := strings.Join(ReplicationCycle(repo), " "); got != tt.want {
+			t.Errorf("ReplicationCycle(%s) = %q, want %q", tt.repo, got, tt.want)
+		}
+	}
+}
+
+// setHome points HOME at dir for the test and clears the variables that
+// would move the config and state directories away from it
+func setHome(t *testing.T, dir string) {
+	t.Helper()
+	t.Setenv("HOME", dir)
+	for _, key := range DirEnvVars {
+		t.Setenv(key, "")
+	}
+}
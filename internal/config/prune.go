@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// PrunePolicy returns the retention policy for a repository: the global
+// policy with every key the repository sets replaced.
+func (r *RepoConfig) PrunePolicy(global PruneConfig) PruneConfig {
+	return mergeOverrides(global, r.Prune, "prune", r.overrides)
+}
+
+// ForgetArgs returns the restic forget flags for the policy
+func (p PruneConfig) ForgetArgs() []string {
+	var args []string
+
+	keep := []struct {
+		flag  string
+		value int
+	}{
+		{"keep-last", p.KeepLast},
+		{"keep-hourly", p.KeepHourly},
+		{"keep-daily", p.KeepDaily},
+		{"keep-weekly", p.KeepWeekly},
+		{"keep-monthly", p.KeepMonthly},
+		{"keep-yearly", p.KeepYearly},
+	}
+	for _, k := range keep {
+		if k.value != 0 {
+			args = append(args, fmt.Sprintf("--%s=%d", k.flag, k.value))
+		}
+	}
+
+	within := []struct {
+		flag  string
+		value string
+	}{
+		{"keep-within", p.KeepWithin},
+		{"keep-within-hourly", p.KeepWithinHourly},
+		{"keep-within-daily", p.KeepWithinDaily},
+		{"keep-within-weekly", p.KeepWithinWeekly},
+		{"keep-within-monthly", p.KeepWithinMonthly},
+		{"keep-within-yearly", p.KeepWithinYearly},
+	}
+	for _, w := range within {
+		if w.value != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", w.flag, w.value))
+		}
+	}
+
+	for _, tag := range p.KeepTag {
+		args = append(args, "--keep-tag="+tag)
+	}
+	if p.GroupBy != "" {
+		args = append(args, "--group-by="+p.GroupBy)
+	}
+	for _, host := range p.Host {
+		args = append(args, "--host="+host)
+	}
+	for _, tag := range p.Tags {
+		args = append(args, "--tag="+tag)
+	}
+
+	return args
+}
+
+// PruneArgs returns the restic prune tuning flags
+func (p PruneConfig) PruneArgs() []string {
+	var args []string
+	if p.MaxUnused != "" {
+		args = append(args, "--max-unused="+p.MaxUnused)
+	}
+	if p.MaxRepackSize != "" {
+		args = append(args, "--max-repack-size="+p.MaxRepackSize)
+	}
+	return args
+}
+
+// PruneInterval returns how long backups wait between prunes
+func (p PruneConfig) PruneInterval() time.Duration {
+	return time.Duration(p.IntervalDays) * 24 * time.Hour
+}
+
+// overlayDefined copies the fields of src whose keys are defined under
+// section into *dst, allocating it on first use, and records the keys
+func overlayDefined[T any](dst **T, src *T, section string, defined func(key ...string) bool, overrides map[string]bool) {
+	from := reflect.ValueOf(src).Elem()
+	for i := 0; i < from.NumField(); i++ {
+		key := tomlKey(from.Type().Field(i))
+		if !defined(section, key) {
+			continue
+		}
+		if *dst == nil {
+			*dst = new(T)
+		}
+		reflect.ValueOf(*dst).Elem().Field(i).Set(from.Field(i))
+		overrides[section+"."+key] = true
+	}
+}
+
+// mergeOverrides returns global with every field of override whose key is
+// recorded under section replaced
+func mergeOverrides[T any](global T, override *T, section string, overrides map[string]bool) T {
+	merged := global
+	if override == nil {
+		return merged
+	}
+
+	// Slices are copied along with the struct, so replace rather than append
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(override).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		if overrides[section+"."+tomlKey(dst.Type().Field(i))] {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return merged
+}
+
+// tomlKey returns the TOML key of a struct field
+func tomlKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	return key
+}
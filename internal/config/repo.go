@@ -0,0 +1,456 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/catflyflyfly/restic-helpers/internal/secrets"
+)
+
+// repoFile holds the settings of a repo.toml file, a [repos.<name>] table or
+// a [profiles.<name>] table
+type repoFile struct {
+	// Extends names the profile the settings are layered over
+	Extends         string            `toml:"extends"`
+	Repository      string            `toml:"repository"`
+	PasswordFile    string            `toml:"password_file"`
+	Password        Secret            `toml:"password"`
+	Paths           []string          `toml:"paths"`
+	Exclude         []string          `toml:"exclude"`
+	Healthcheck     string            `toml:"healthcheck"`
+	PartialSnapshot string            `toml:"partial_snapshot"`
+	ReplicateTo     []string          `toml:"replicate_to"`
+	Prune           PruneConfig       `toml:"prune"`
+	Retry           RetryConfig       `toml:"retry"`
+	Telegram        TelegramConfig    `toml:"telegram"`
+	Env             map[string]Secret `toml:"env"`
+}
+
+// repoSource is a decoded repo.toml file, [repos.<name>] or [profiles.<name>] table
+type repoSource struct {
+	// name describes the source in RepoConfig.Sources
+	name string
+	// dir is where relative paths are resolved from
+	dir    string
+	values repoFile
+	// defined reports whether a key is set in the source
+	defined func(key ...string) bool
+}
+
+// loadRepoFile loads a repos/<name>/repo.toml file
+func loadRepoFile(path string) (*repoSource, error) {
+	source := &repoSource{name: path, dir: filepath.Dir(path)}
+	md, err := toml.DecodeFile(path, &source.values)
+	if err == nil {
+		err = checkUnknownKeys(path, unknownKeys(md))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repo.toml: %w", err)
+	}
+	source.defined = md.IsDefined
+	return source, nil
+}
+
+// loadRepoTable loads the [repos.<name>] table of config.toml, or returns nil if there is none
+func loadRepoTable(configFile, name string) (*repoSource, error) {
+	return loadTable(configFile, "repos", name)
+}
+
+// loadProfile loads the [profiles.<name>] table of config.toml
+func loadProfile(configFile, name string) (*repoSource, error) {
+	source, err := loadTable(configFile, "profiles", name)
+	if err == nil && source == nil {
+		err = fmt.Errorf("profile %q does not exist in config.toml", name)
+	}
+	return source, err
+}
+
+// loadTable loads the [<section>.<name>] table of config.toml, or returns nil if there is none
+func loadTable(configFile, section, name string) (*repoSource, error) {
+	var doc map[string]map[string]toml.Primitive
+	md, err := toml.DecodeFile(configFile, &doc)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config.toml: %w", err)
+	}
+
+	table, ok := doc[section][name]
+	if !ok {
+		return nil, nil
+	}
+
+	source := &repoSource{name: fmt.Sprintf("%s [%s.%s]", configFile, section, name), dir: filepath.Dir(configFile)}
+	err = md.PrimitiveDecode(table, &source.values)
+	if err == nil {
+		err = checkUnknownKeys(source.name, unknownKeys(md, section, name))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load [%s.%s] from config.toml: %w", section, name, err)
+	}
+	source.defined = func(key ...string) bool {
+		return md.IsDefined(append([]string{section, name}, key...)...)
+	}
+	return source, nil
+}
+
+// repoTableNames returns the names of the [repos.<name>] tables in config.toml
+func repoTableNames(configFile string) ([]string, error) {
+	var doc struct {
+		Repos map[string]toml.Primitive `toml:"repos"`
+	}
+	if _, err := toml.DecodeFile(configFile, &doc); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load config.toml: %w", err)
+	}
+
+	names := make([]string, 0, len(doc.Repos))
+	for name := range doc.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// applyProfile applies a profile and the profiles it extends, base first
+func (r *RepoConfig) applyProfile(configFile, name string, seen []string) error {
+	if slices.Contains(seen, name) {
+		return fmt.Errorf("profile %q extends itself: %s", name, strings.Join(append(seen, name), " -> "))
+	}
+
+	profile, err := loadProfile(configFile, name)
+	if err != nil {
+		return err
+	}
+	if profile.defined("extends") {
+		if err := r.applyProfile(configFile, profile.values.Extends, append(seen, name)); err != nil {
+			return err
+		}
+	}
+	return r.apply(profile)
+}
+
+// apply overrides the repository config with every key set in a source
+func (r *RepoConfig) apply(source *repoSource) error {
+	v := source.values
+
+	if source.defined("repository") {
+		r.Repository = v.Repository
+		r.RepoFile = ""
+	}
+	if source.defined("password_file") {
+		r.Password = Secret{File: resolvePath(source.dir, v.PasswordFile)}
+	}
+	if source.defined("password") {
+		// Keep the repository password out of config files that get shared or printed
+		if v.Password.Value != "" {
+			return fmt.Errorf("%s: password must be a table with file, command or env", source.name)
+		}
+		r.Password = v.Password.withBaseDir(source.dir)
+	}
+	if source.defined("paths") {
+		r.Paths = make([]string, len(v.Paths))
+		for i, path := range v.Paths {
+			r.Paths[i] = expandHome(path)
+		}
+		r.PathsFile = ""
+	}
+	if source.defined("exclude") {
+		r.Excludes = v.Exclude
+		r.ExcludeFile = ""
+	}
+	if source.defined("healthcheck") {
+		r.Healthcheck = v.Healthcheck
+	}
+	if source.defined("partial_snapshot") {
+		if v.PartialSnapshot != PartialFail && v.PartialSnapshot != PartialWarn {
+			return fmt.Errorf("%s: partial_snapshot must be %q or %q, not %q", source.name, PartialFail, PartialWarn, v.PartialSnapshot)
+		}
+		r.PartialSnapshot = v.PartialSnapshot
+	}
+	if source.defined("replicate_to") {
+		if slices.Contains(v.ReplicateTo, r.Name) {
+			return fmt.Errorf("%s: replicate_to cannot list %s itself", source.name, r.Name)
+		}
+		r.ReplicateTo = v.ReplicateTo
+	}
+	// Environment variables merge per variable, like the sections below
+	for key, value := range v.Env {
+		if r.Environment == nil {
+			r.Environment = make(map[string]Secret)
+		}
+		r.Environment[key] = value.withBaseDir(source.dir)
+	}
+
+	overlayDefined(&r.Prune, &v.Prune, "prune", source.defined, r.overrides)
+	overlayDefined(&r.Retry, &v.Retry, "retry", source.defined, r.overrides)
+	overlayDefined(&r.Telegram, &v.Telegram, "telegram", source.defined, r.overrides)
+	if r.Telegram != nil && source.defined("telegram", "bot_token") {
+		r.Telegram.BotToken = r.Telegram.BotToken.withBaseDir(source.dir)
+	}
+
+	r.Sources = append(r.Sources, source.name)
+	return nil
+}
+
+// RetryPolicy returns the global retry config with every key the repository sets replaced
+func (r *RepoConfig) RetryPolicy(global RetryConfig) RetryConfig {
+	return mergeOverrides(global, r.Retry, "retry", r.overrides)
+}
+
+// TelegramSettings returns the global Telegram config with every key the repository sets replaced
+func (r *RepoConfig) TelegramSettings(global TelegramConfig) TelegramConfig {
+	return mergeOverrides(global, r.Telegram, "telegram", r.overrides)
+}
+
+// RepoArgs returns the restic flags selecting the repository and its password.
+// A password from an environment variable or an encrypted file is passed with
+// ResticEnv instead.
+func (r *RepoConfig) RepoArgs() []string {
+	var args []string
+	if r.Repository != "" {
+		args = append(args, "--repo="+r.Repository)
+	} else {
+		args = append(args, "--repository-file="+r.RepoFile)
+	}
+	switch {
+	case secrets.IsEncrypted(r.Password.File):
+	case r.Password.File != "":
+		args = append(args, "--password-file="+r.Password.File)
+	case r.Password.Command != "":
+		args = append(args, "--password-command="+r.Password.Command)
+	}
+	return args
+}
+
+// FromRepoArgs returns RepoArgs as the --from-* flags of restic copy, which
+// reads snapshots from the repository
+func (r *RepoConfig) FromRepoArgs() []string {
+	args := r.RepoArgs()
+	for i, arg := range args {
+		args[i] = "--from-" + strings.TrimPrefix(arg, "--")
+	}
+	return args
+}
+
+// FromResticEnv returns ResticEnv for restic copy reading from the
+// repository, with its password as RESTIC_FROM_PASSWORD
+func (r *RepoConfig) FromResticEnv() ([]string, error) {
+	env, err := r.ResticEnv()
+	if err != nil {
+		return nil, err
+	}
+	for i, kv := range env {
+		if password, ok := strings.CutPrefix(kv, "RESTIC_PASSWORD="); ok {
+			env[i] = "RESTIC_FROM_PASSWORD=" + password
+		}
+	}
+	return env, nil
+}
+
+// CopyEnv returns the environment of restic copy from source into target.
+// Backend variables such as B2_ACCOUNT_KEY have no --from-* form, so a
+// variable the two set to different values is an error instead of the
+// target's value reaching the source.
+func CopyEnv(source, target *RepoConfig) ([]string, error) {
+	fromEnv, err := source.FromResticEnv()
+	if err != nil {
+		return nil, err
+	}
+	targetEnv, err := target.ResticEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, kv := range targetEnv {
+		key, value, _ := strings.Cut(kv, "=")
+		values[key] = value
+	}
+	var conflicts []string
+	for _, kv := range fromEnv {
+		key, value, _ := strings.Cut(kv, "=")
+		if targetValue, ok := values[key]; ok && targetValue != value {
+			conflicts = append(conflicts, key)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%s and %s set %s to different values, which restic copy cannot tell apart",
+			source.Name, target.Name, strings.Join(conflicts, ", "))
+	}
+	return append(fromEnv, targetEnv...), nil
+}
+
+// ReplicationCycle returns a replicate_to cycle through the repository, e.g.
+// [laptop offsite laptop], or nil if there is none. Runs that wait for each
+// other's lock along a cycle deadlock. Targets that fail to load are skipped.
+func ReplicationCycle(source *RepoConfig) []string {
+	visited := map[string]bool{source.Name: true}
+	var walk func(repo *RepoConfig, path []string) []string
+	walk = func(repo *RepoConfig, path []string) []string {
+		for _, target := range repo.ReplicateTo {
+			if target == source.Name {
+				return append(path, target)
+			}
+			if visited[target] {
+				continue
+			}
+			visited[target] = true
+			targetCfg, err := LoadRepo(target)
+			if err != nil {
+				continue
+			}
+			if cycle := walk(targetCfg, append(slices.Clip(path), target)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return walk(source, []string{source.Name})
+}
+
+// ResticEnv returns the environment variables, as KEY=value, that restic
+// needs on top of RepoArgs: the env table and a password that has no flag.
+// They may hold secrets, so never print them.
+func (r *RepoConfig) ResticEnv() ([]string, error) {
+	var env []string
+	for _, key := range r.envKeys() {
+		value, err := r.Environment[key].Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env %s: %w", key, err)
+		}
+		env = append(env, key+"="+value)
+	}
+
+	if r.Password.Env == "" && !secrets.IsEncrypted(r.Password.File) {
+		return env, nil
+	}
+	password, err := r.Password.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository password: %w", err)
+	}
+	return append(env, "RESTIC_PASSWORD="+password), nil
+}
+
+// envKeys returns the env table keys in order
+func (r *RepoConfig) envKeys() []string {
+	keys := make([]string, 0, len(r.Environment))
+	for key := range r.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ExcludeArgs returns the restic backup flags for the repository's exclusions
+func (r *RepoConfig) ExcludeArgs() []string {
+	var args []string
+	if r.ExcludeFile != "" {
+		args = append(args, "--exclude-file="+r.ExcludeFile)
+	}
+	for _, pattern := range r.Excludes {
+		args = append(args, "--exclude="+pattern)
+	}
+	return args
+}
+
+// PathArgs returns the restic backup arguments selecting what to back up.
+// Inline paths follow "--", so these must come last.
+func (r *RepoConfig) PathArgs() []string {
+	if r.PathsFile != "" {
+		return []string{"--files-from=" + r.PathsFile}
+	}
+	return append([]string{"--"}, r.Paths...)
+}
+
+// RequiredFiles returns the files restic reads to open the repository
+func (r *RepoConfig) RequiredFiles() []string {
+	var files []string
+	if r.RepoFile != "" {
+		files = append(files, r.RepoFile)
+	}
+	if r.Password.File != "" {
+		files = append(files, r.Password.File)
+	}
+	return files
+}
+
+// Env returns the environment variables, as KEY=value, that set up restic
+// for the repository in a shell script. Values are escaped for double quotes
+// and secrets are not resolved: an environment variable is referenced as
+// $NAME, files and commands are read with $(...) and an encrypted password
+// is decrypted by a password command.
+func (r *RepoConfig) Env() []string {
+	var env []string
+	if r.Repository != "" {
+		env = append(env, "RESTIC_REPOSITORY="+shellEscape(r.Repository))
+	} else {
+		env = append(env, "RESTIC_REPOSITORY_FILE="+shellEscape(r.RepoFile))
+	}
+	switch {
+	case secrets.IsEncrypted(r.Password.File):
+		env = append(env, "RESTIC_PASSWORD_COMMAND="+shellEscape(fmt.Sprintf("%s secrets decrypt %q", AppName, r.Password.File)))
+	case r.Password.File != "":
+		env = append(env, "RESTIC_PASSWORD_FILE="+shellEscape(r.Password.File))
+	case r.Password.Command != "":
+		env = append(env, "RESTIC_PASSWORD_COMMAND="+shellEscape(r.Password.Command))
+	case r.Password.Env != "":
+		env = append(env, "RESTIC_PASSWORD=$"+r.Password.Env)
+	}
+
+	for _, key := range r.envKeys() {
+		env = append(env, key+"="+shellValue(r.Environment[key]))
+	}
+	return env
+}
+
+// shellValue returns a shell expression, for double quotes, that reads a secret
+func shellValue(s Secret) string {
+	switch {
+	case secrets.IsEncrypted(s.File):
+		return fmt.Sprintf("$(%s secrets decrypt '%s')", AppName, s.File)
+	case s.File != "":
+		return fmt.Sprintf("$(cat '%s')", s.File)
+	case s.Command != "":
+		return "$(" + s.Command + ")"
+	case s.Env != "":
+		return "$" + s.Env
+	default:
+		return shellEscape(s.Value)
+	}
+}
+
+// shellEscape escapes a literal value for double quotes in a shell script
+func shellEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`).Replace(value)
+}
+
+// resolvePath expands a leading ~ and makes a relative path relative to dir
+func resolvePath(dir, path string) string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, rest)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaKinds are the config files Schema describes
+var SchemaKinds = []string{"config", "repo", "prune", "schedule"}
+
+// Schema returns a JSON Schema for a config file: "config" for config.toml
+// and secret.toml, "repo" for repos/<name>/repo.toml, "prune" for prune.toml
+// or "schedule" for schedule.toml. Unknown keys are rejected, as on load.
+func Schema(kind string) (map[string]any, error) {
+	var schema map[string]any
+	switch kind {
+	case "config":
+		schema = schemaOf(reflect.TypeFor[Config]())
+		// [repos.<name>] and [profiles.<name>] take the keys of repo.toml
+		repo := schemaOf(reflect.TypeFor[repoFile]())
+		properties := schema["properties"].(map[string]any)
+		properties["repos"] = map[string]any{"type": "object", "additionalProperties": repo}
+		properties["profiles"] = map[string]any{"type": "object", "additionalProperties": repo}
+	case "repo":
+		schema = schemaOf(reflect.TypeFor[repoFile]())
+	case "prune":
+		schema = schemaOf(reflect.TypeFor[PruneConfig]())
+	case "schedule":
+		schema = schemaOf(reflect.TypeFor[ScheduleConfig]())
+	default:
+		return nil, fmt.Errorf("unknown schema %q (expected one of %s)", kind, strings.Join(SchemaKinds, ", "))
+	}
+
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = fmt.Sprintf("%s %s.toml", AppName, kind)
+	return schema, nil
+}
+
+// schemaOf returns the JSON Schema of a type decoded from TOML
+func schemaOf(t reflect.Type) map[string]any {
+	if t == reflect.TypeFor[Secret]() {
+		return secretSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if key := tomlKey(field); field.IsExported() && key != "" && key != "-" {
+				properties[key] = schemaOf(field.Type)
+			}
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	}
+	return map[string]any{}
+}
+
+// secretSchema accepts a Secret's plain string or its table with exactly one source
+func secretSchema() map[string]any {
+	sources := map[string]any{}
+	for _, key := range []string{"file", "command", "env"} {
+		sources[key] = map[string]any{"type": "string"}
+	}
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{
+				"type":                 "object",
+				"properties":           sources,
+				"additionalProperties": false,
+				"minProperties":        1,
+				"maxProperties":        1,
+			},
+		},
+	}
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/catflyflyfly/restic-helpers/internal/secrets"
+)
+
+// Secret is a sensitive value and where to read it from. In TOML it is either
+// a plain string or a table with exactly one of file, command or env, e.g.
+// { command = "pass show backup/laptop" }.
+type Secret struct {
+	// Value is the secret itself, given inline
+	Value string
+	// File is a file holding the secret, e.g. /dev/fd/3 to read a file
+	// descriptor. Files ending in .age are decrypted with IdentityPath.
+	File string
+	// Command prints the secret on standard output
+	Command string
+	// Env is the environment variable holding the secret
+	Env string
+}
+
+// UnmarshalTOML decodes a plain string or a {file, command, env} table
+func (s *Secret) UnmarshalTOML(data any) error {
+	switch v := data.(type) {
+	case string:
+		*s = Secret{Value: v}
+		return nil
+	case map[string]any:
+		*s = Secret{}
+		for key, value := range v {
+			str, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("secret %s must be a string", key)
+			}
+			if strings.TrimSpace(str) == "" {
+				return fmt.Errorf("secret %s must not be empty", key)
+			}
+			switch key {
+			case "file":
+				s.File = str
+			case "command":
+				s.Command = str
+			case "env":
+				s.Env = str
+			default:
+				return fmt.Errorf("unknown secret source %q (want file, command or env)", key)
+			}
+		}
+		if len(v) != 1 {
+			return fmt.Errorf("secret needs exactly one of file, command or env")
+		}
+		return nil
+	default:
+		return fmt.Errorf("secret must be a string or a table with file, command or env")
+	}
+}
+
+// MarshalJSON describes the secret's source and masks an inline value
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if s.Value != "" {
+		return json.Marshal("***")
+	}
+	return json.Marshal(struct {
+		File    string `json:"file,omitempty"`
+		Command string `json:"command,omitempty"`
+		Env     string `json:"env,omitempty"`
+	}{s.File, s.Command, s.Env})
+}
+
+// IsSet reports whether the secret has a source
+func (s Secret) IsSet() bool {
+	return s.Value != "" || s.File != "" || s.Command != "" || s.Env != ""
+}
+
+// String describes where the secret comes from, never the secret itself
+func (s Secret) String() string {
+	switch {
+	case s.File != "":
+		return "file " + s.File
+	case s.Command != "":
+		return fmt.Sprintf("command %q", s.Command)
+	case s.Env != "":
+		return "env $" + s.Env
+	case s.Value != "":
+		return "inline value"
+	default:
+		return "not set"
+	}
+}
+
+// Resolve reads the secret from its source. Commands run with /bin/sh and
+// trailing newlines are trimmed from files and command output.
+func (s Secret) Resolve() (string, error) {
+	switch {
+	case secrets.IsEncrypted(s.File):
+		data, err := decryptFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case s.Command != "":
+		cmd := exec.Command("/bin/sh", "-c", s.Command)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run secret command %q: %w", s.Command, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	case s.Env != "":
+		value := os.Getenv(s.Env)
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	default:
+		return s.Value, nil
+	}
+}
+
+// withBaseDir returns the secret with a relative file path resolved from dir
+func (s Secret) withBaseDir(dir string) Secret {
+	if s.File != "" {
+		s.File = resolvePath(dir, s.File)
+	}
+	return s
+}
+
+// IdentityPath returns the age identity file that decrypts *.age secrets:
+// X_RESTIC_AGE_IDENTITY, [age] identity in config.toml, or age.key in the
+// config directory
+func IdentityPath() (string, error) {
+	paths, err := GetPaths()
+	if err != nil {
+		return "", err
+	}
+
+	identity := os.Getenv(EnvPrefix + "AGE_IDENTITY")
+	if identity == "" {
+		var doc struct {
+			Age AgeConfig `toml:"age"`
+		}
+		configFile := filepath.Join(paths.ConfigDir, "config.toml")
+		if _, err := toml.DecodeFile(configFile, &doc); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to load config.toml: %w", err)
+		}
+		identity = doc.Age.Identity
+	}
+	if identity == "" {
+		identity = "age.key"
+	}
+
+	return resolvePath(paths.ConfigDir, identity), nil
+}
+
+// decryptFile decrypts an age-encrypted file with the configured identity
+func decryptFile(path string) ([]byte, error) {
+	identity, err := IdentityPath()
+	if err != nil {
+		return nil, err
+	}
+	return secrets.DecryptFile(path, identity)
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/catflyflyfly/restic-helpers/internal/secrets"
+)
+
+func TestSecretDecode(t *testing.T) {
+	var doc struct {
+		Inline  Secret `toml:"inline"`
+		File    Secret `toml:"file"`
+		Command Secret `toml:"command"`
+		Env     Secret `toml:"env"`
+	}
+	_, err := toml.Decode(`
+inline = "token"
+file = { file = "token.txt" }
+command = { command = "pass show telegram" }
+[env]
+env = "BOT_TOKEN"
+`, &doc)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if doc.Inline != (Secret{Value: "token"}) {
+		t.Errorf("inline = %+v", doc.Inline)
+	}
+	if doc.File != (Secret{File: "token.txt"}) {
+		t.Errorf("file = %+v", doc.File)
+	}
+	if doc.Command != (Secret{Command: "pass show telegram"}) {
+		t.Errorf("command = %+v", doc.Command)
+	}
+	if doc.Env != (Secret{Env: "BOT_TOKEN"}) {
+		t.Errorf("env = %+v", doc.Env)
+	}
+
+	for _, input := range []string{
+		`s = { file = "a", env = "B" }`,
+		`s = { path = "a" }`,
+		`s = {}`,
+		`s = { command = "  " }`,
+		`s = { file = "" }`,
+		`s = 3`,
+	} {
+		var bad struct {
+			S Secret `toml:"s"`
+		}
+		if _, err := toml.Decode(input, &bad); err == nil {
+			t.Errorf("expected %q to fail", input)
+		}
+	}
+}
+
+func TestSecretResolve(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET", "from-env")
+
+	tests := []struct {
+		secret Secret
+		want   string
+	}{
+		{Secret{Value: "inline"}, "inline"},
+		{Secret{File: file}, "from-file"},
+		{Secret{Command: "echo from-command"}, "from-command"},
+		{Secret{Env: "TEST_SECRET"}, "from-env"},
+	}
+	for _, tt := range tests {
+		got, err := tt.secret.Resolve()
+		if err != nil {
+			t.Errorf("Resolve(%s) failed: %v", tt.secret, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%s) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+
+	if _, err := (Secret{Env: "TEST_SECRET_UNSET"}).Resolve(); err == nil {
+		t.Error("expected an unset environment variable to fail")
+	}
+}
+
+func TestSecretNeverPrinted(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Telegram.BotToken = Secret{Value: "s3cret"}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("expected the token to be masked, got %s", data)
+	}
+	if s := cfg.Telegram.BotToken.String(); strings.Contains(s, "s3cret") {
+		t.Errorf("String() = %q leaks the token", s)
+	}
+}
+
+func TestLoadRepoPasswordSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, ".config", "restic-helpers", "repos", "laptop")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	setHome(t, tmpDir)
+
+	tests := []struct {
+		repoTOML string
+		args     string
+		env      string
+		files    int
+	}{
+		{`password = { file = "pw" }`, "--password-file=" + filepath.Join(repoDir, "pw"), "RESTIC_PASSWORD_FILE=" + filepath.Join(repoDir, "pw"), 2},
+		{`password = { command = "pass show backup/laptop" }`, "--password-command=pass show backup/laptop", "RESTIC_PASSWORD_COMMAND=pass show backup/laptop", 1},
+		{`password = { env = "LAPTOP_PASSWORD" }`, "", "RESTIC_PASSWORD=$LAPTOP_PASSWORD", 1},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(tt.repoTOML), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		repo, err := LoadRepo("laptop")
+		if err != nil {
+			t.Fatalf("LoadRepo(%s) failed: %v", tt.repoTOML, err)
+		}
+
+		args := repo.RepoArgs()
+		if got := strings.Join(args[1:], " "); got != tt.args {
+			t.Errorf("%s: RepoArgs() password = %q, want %q", tt.repoTOML, got, tt.args)
+		}
+		if env := repo.Env(); env[len(env)-1] != tt.env {
+			t.Errorf("%s: Env() password = %q, want %q", tt.repoTOML, env[len(env)-1], tt.env)
+		}
+		if got := len(repo.RequiredFiles()); got != tt.files {
+			t.Errorf("%s: RequiredFiles() = %q", tt.repoTOML, repo.RequiredFiles())
+		}
+	}
+
+	t.Setenv("LAPTOP_PASSWORD", "hunter2")
+	repo, err := LoadRepo("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := repo.ResticEnv()
+	if err != nil || len(env) != 1 || env[0] != "RESTIC_PASSWORD=hunter2" {
+		t.Errorf("ResticEnv() = %q, %v", env, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, "repo.toml"), []byte(`password = "hunter2"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRepo("laptop"); err == nil {
+		t.Error("expected an inline repository password to be rejected")
+	}
+}
+
+func TestLoadPrefersEncryptedSecrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".config", "restic-helpers")
+	repoDir := filepath.Join(configDir, "repos", "laptop")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	setHome(t, tmpDir)
+
+	identity := filepath.Join(tmpDir, "keys", "restic.key")
+	if _, err := secrets.GenerateIdentity(identity); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(configDir, "config.toml"): "[age]\nidentity = \"~/keys/restic.key\"\n",
+		filepath.Join(configDir, "secret.toml"): "[telegram]\nbot_token = \"plain\"\n",
+		filepath.Join(repoDir, "password.txt"):  "plain\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := secrets.EncryptFile(filepath.Join(configDir, "secret.toml.age"), []byte("[telegram]\nbot_token = \"encrypted\"\n"), identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := secrets.EncryptFile(filepath.Join(repoDir, "password.txt.age"), []byte("hunter2\n"), identity); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Telegram.BotToken.Value != "encrypted" {
+		t.Errorf("expected bot_token from secret.toml.age, got %q", cfg.Telegram.BotToken.Value)
+	}
+
+	repo, err := LoadRepo("laptop")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+	if repo.Password.File != filepath.Join(repoDir, "password.txt.age") {
+		t.Errorf("expected password.txt.age, got %q", repo.Password.File)
+	}
+	if args := repo.RepoArgs(); len(args) != 1 {
+		t.Errorf("expected no password flag for an encrypted file, got %q", args)
+	}
+	env, err := repo.ResticEnv()
+	if err != nil || len(env) != 1 || env[0] != "RESTIC_PASSWORD=hunter2" {
+		t.Errorf("ResticEnv() = %q, %v", env, err)
+	}
+}
+
+func TestLoadRepoEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".config", "restic-helpers")
+	repoDir := filepath.Join(configDir, "repos", "cloud")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	setHome(t, tmpDir)
+	t.Setenv("MY_B2_KEY", "key$1")
+
+	files := map[string]string{
+		filepath.Join(configDir, "config.toml"): `
+[repos.cloud.env]
+B2_ACCOUNT_ID = "from-table"
+AWS_DEFAULT_REGION = "eu-west-1"
+`,
+		filepath.Join(repoDir, "repo.toml"): `
+repository = "b2:bucket:/cloud"
+password_file = "pw"
+
+[env]
+B2_ACCOUNT_ID = "id"
+B2_ACCOUNT_KEY = { env = "MY_B2_KEY" }
+AWS_SESSION_TOKEN = { file = "token" }
+`,
+		filepath.Join(repoDir, "token"): "session\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo, err := LoadRepo("cloud")
+	if err != nil {
+		t.Fatalf("LoadRepo failed: %v", err)
+	}
+
+	// Variables merge one by one, repo.toml winning
+	env, err := repo.ResticEnv()
+	if err != nil {
+		t.Fatalf("ResticEnv failed: %v", err)
+	}
+	want := "AWS_DEFAULT_REGION=eu-west-1 AWS_SESSION_TOKEN=session B2_ACCOUNT_ID=id B2_ACCOUNT_KEY=key$1"
+	if got := strings.Join(env, " "); got != want {
+		t.Errorf("ResticEnv() = %q, want %q", got, want)
+	}
+
+	shell := strings.Join(repo.Env(), "\n")
+	for _, line := range []string{
+		"AWS_SESSION_TOKEN=$(cat '" + filepath.Join(repoDir, "token") + "')",
+		"B2_ACCOUNT_KEY=$MY_B2_KEY",
+	} {
+		if !strings.Contains(shell, line) {
+			t.Errorf("Env() has no %q:\n%s", line, shell)
+		}
+	}
+	if strings.Contains(shell, "key$1") || strings.Contains(shell, "session\n") {
+		t.Errorf("Env() resolved a secret:\n%s", shell)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LenientEnv reports unknown keys in config files as warnings instead of
+// errors, like the --lenient flag
+const LenientEnv = EnvPrefix + "LENIENT"
+
+// warned holds the unknown keys already warned about, since files are
+// loaded more than once per run
+var warned sync.Map
+
+// unknownKeys returns the keys under prefix that no setting decoded, which
+// are usually typos. Keys inside an unknown table are left out.
+func unknownKeys(md toml.MetaData, prefix ...string) []string {
+	var keys []string
+	var tables []toml.Key
+	for _, key := range md.Undecoded() {
+		if len(key) <= len(prefix) || !slices.Equal([]string(key[:len(prefix)]), prefix) {
+			continue
+		}
+		if slices.ContainsFunc(tables, func(table toml.Key) bool { return isPrefix(table, key) }) {
+			continue
+		}
+		if md.Type(key...) == "Hash" {
+			tables = append(tables, key)
+		}
+		keys = append(keys, toml.Key(key[len(prefix):]).String())
+	}
+	return keys
+}
+
+// isPrefix reports whether key is inside table
+func isPrefix(table, key toml.Key) bool {
+	return len(key) > len(table) && slices.Equal(table, key[:len(table)])
+}
+
+// checkUnknownKeys returns an error naming the unknown keys of a file, or
+// prints a warning instead when X_RESTIC_LENIENT is set
+func checkUnknownKeys(file string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("%s: unknown keys %s (use --lenient to ignore)", file, strings.Join(keys, ", "))
+	if !isLenient() {
+		return err
+	}
+	if _, ok := warned.LoadOrStore(err.Error(), true); !ok {
+		fmt.Fprintf(os.Stderr, "Warning: %s: unknown keys %s\n", file, strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// isLenient reports whether X_RESTIC_LENIENT is set to a true value
+func isLenient() bool {
+	var lenient bool
+	setEnvBool(&lenient, LenientEnv)
+	return lenient
+}
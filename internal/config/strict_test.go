@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".config", "restic-helpers")
+	repoDir := filepath.Join(configDir, "repos", "laptop")
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	setHome(t, tmpDir)
+
+	tests := []struct {
+		file    string
+		content string
+		load    func() error
+		want    string
+	}{
+		{
+			file:    filepath.Join(configDir, "config.toml"),
+			content: "[prune]\nkeep_dailly = 7\n\n[repos.laptop]\nrepository = \"/srv\"\n\n[unknown]\na = 1\n",
+			load:    func() error { _, err := Load(); return err },
+			want:    "unknown keys prune.keep_dailly, unknown",
+		},
+		{
+			file:    filepath.Join(configDir, "secret.toml"),
+			content: "[telegram]\nbot_tokn = \"x\"\n",
+			load:    func() error { _, err := Load(); return err },
+			want:    "unknown keys telegram.bot_tokn",
+		},
+		{
+			file:    filepath.Join(configDir, "config.toml"),
+			content: "[repos.laptop]\nrepository = \"/srv\"\n\n[repos.laptop.prune]\nkeep_dailly = 7\n",
+			load:    func() error { _, err := LoadRepo("laptop"); return err },
+			want:    "[repos.laptop]: unknown keys prune.keep_dailly",
+		},
+		{
+			file:    filepath.Join(repoDir, "repo.toml"),
+			content: "repository = \"/srv\"\npaht = [\"/etc\"]\n",
+			load:    func() error { _, err := LoadRepo("laptop"); return err },
+			want:    "unknown keys paht",
+		},
+		{
+			file:    filepath.Join(repoDir, "prune.toml"),
+			content: "keep_dailly = 7\n",
+			load:    func() error { _, err := LoadRepo("laptop"); return err },
+			want:    "unknown keys keep_dailly",
+		},
+		{
+			file:    filepath.Join(repoDir, "schedule.toml"),
+			content: "backup = \"0 2 * * *\"\njitter = 60\n",
+			load:    func() error { _, err := LoadRepo("laptop"); return err },
+			want:    "unknown keys jitter",
+		},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(tt.file, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		err := tt.load()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", filepath.Base(tt.file), err, tt.want)
+		}
+
+		t.Setenv(LenientEnv, "1")
+		if err := tt.load(); err != nil {
+			t.Errorf("%s: lenient load failed: %v", filepath.Base(tt.file), err)
+		}
+		t.Setenv(LenientEnv, "")
+
+		if err := os.Remove(tt.file); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := Schema("config")
+	if err != nil {
+		t.Fatalf("Schema failed: %v", err)
+	}
+
+	properties := schema["properties"].(map[string]any)
+	repos := properties["repos"].(map[string]any)["additionalProperties"].(map[string]any)
+	repoProperties := repos["properties"].(map[string]any)
+	for _, key := range []string{"extends", "password", "env"} {
+		if _, ok := repoProperties[key]; !ok {
+			t.Errorf("expected %s in the [repos.<name>] schema", key)
+		}
+	}
+	prune := properties["prune"].(map[string]any)
+	if prune["additionalProperties"] != false {
+		t.Error("expected unknown [prune] keys to be rejected")
+	}
+	if _, ok := prune["properties"].(map[string]any)["keep_daily"]; !ok {
+		t.Error("expected keep_daily in the [prune] schema")
+	}
+
+	if _, err := Schema("unknown"); err == nil {
+		t.Error("expected an unknown schema to fail")
+	}
+}
@@ -2,6 +2,7 @@ package cron
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -25,21 +26,14 @@ func setMonth(ci *CalendarInterval, v int)   { ci.Month = &v }
 const MaxScheduleEntries = 50
 
 // ParseCron parses a cron expression and returns calendar intervals for launchd.
+// Expressions with a timezone prefix are shifted into local time.
 func ParseCron(expr string) ([]CalendarInterval, error) {
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(expr)
+	schedule, err := Parse(expr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid cron expression: %w", err)
+		return nil, err
 	}
 
-	// Type assert to access the parsed bit fields directly.
-	// SpecSchedule stores each cron field as a uint64 bit set.
-	spec, ok := schedule.(*cron.SpecSchedule)
-	if !ok {
-		return nil, fmt.Errorf("unexpected schedule type")
-	}
-
-	return expandSpec(spec)
+	return schedule.Intervals()
 }
 
 // expandSpec expands a SpecSchedule into calendar intervals.
@@ -57,6 +51,21 @@ func expandSpec(spec *cron.SpecSchedule) ([]CalendarInterval, error) {
 		return nil, fmt.Errorf("cron expression is all wildcards")
 	}
 
+	// Cron fires when either day-of-month or day-of-week matches if both are
+	// restricted, while launchd requires every set key to match. Expand each
+	// day field separately in that case.
+	if days != nil && weekdays != nil {
+		byDay := max(1, len(minutes)) * max(1, len(hours)) * len(days) * max(1, len(months))
+		byWeekday := max(1, len(minutes)) * max(1, len(hours)) * len(weekdays) * max(1, len(months))
+		if count := byDay + byWeekday; count > MaxScheduleEntries {
+			return nil, fmt.Errorf("cron expression expands to %d entries (max %d)", count, MaxScheduleEntries)
+		}
+		return append(
+			intervalCombinations(minutes, hours, days, nil, months),
+			intervalCombinations(minutes, hours, nil, weekdays, months)...,
+		), nil
+	}
+
 	// Calculate total combinations for the cartesian product.
 	count := max(1, len(minutes)) * max(1, len(hours)) * max(1, len(days)) * max(1, len(months)) * max(1, len(weekdays))
 	if count > MaxScheduleEntries {
@@ -111,3 +120,33 @@ func expandCombinations(intervals []CalendarInterval, vals []int, setter func(*C
 	}
 	return result
 }
+
+// Validate checks that a cron expression can be parsed.
+func Validate(expr string) error {
+	_, err := Parse(expr)
+	return err
+}
+
+// NextRuns returns the next n fire times of a cron expression after from,
+// in the schedule's location (local time unless the expression says otherwise).
+func NextRuns(expr string, from time.Time, n int) ([]time.Time, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("count must be at least 1, got %d", n)
+	}
+
+	schedule, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]time.Time, 0, n)
+	t := from
+	for range n {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs, nil
+}
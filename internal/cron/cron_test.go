@@ -2,6 +2,7 @@ package cron
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParseCronValid(t *testing.T) {
@@ -160,3 +161,106 @@ func ptrEqual(a, b *int) bool {
 	}
 	return *a == *b
 }
+
+func TestNextRuns(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local) // a Thursday
+
+	runs, err := NextRuns("0 2 * * 1", from, 3)
+	if err != nil {
+		t.Fatalf("NextRuns() error = %v", err)
+	}
+
+	want := []time.Time{
+		time.Date(2026, 1, 5, 2, 0, 0, 0, time.Local),
+		time.Date(2026, 1, 12, 2, 0, 0, 0, time.Local),
+		time.Date(2026, 1, 19, 2, 0, 0, 0, time.Local),
+	}
+	if len(runs) != len(want) {
+		t.Fatalf("NextRuns() = %v, want %v", runs, want)
+	}
+	for i := range runs {
+		if !runs[i].Equal(want[i]) || runs[i].Weekday() != time.Monday {
+			t.Errorf("runs[%d] = %v, want %v", i, runs[i], want[i])
+		}
+	}
+}
+
+func TestNextRunsInvalidCount(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if _, err := NextRuns("0 2 * * 1", time.Now(), n); err == nil {
+			t.Errorf("NextRuns(n=%d) expected error", n)
+		}
+	}
+}
+
+// TestCalendarIntervalsMatchSpec checks that launchd fires at exactly the
+// times the cron spec does, minute by minute over a year.
+func TestCalendarIntervalsMatchSpec(t *testing.T) {
+	exprs := []string{
+		"0 2 * * *",
+		"0 2 * * 1",
+		"0 9 * * 1-5",
+		"30 14 15 * *",
+		"0 6,18 * * *",
+		"0 0 1 1,7 *",
+		"0 3 1 * 0",
+		"15 4 1,15 * 1,3",
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	until := from.AddDate(1, 0, 0)
+
+	for _, expr := range exprs {
+		t.Run(expr, func(t *testing.T) {
+			intervals, err := ParseCron(expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+
+			runs, err := NextRuns(expr, from.Add(-time.Minute), 1000)
+			if err != nil {
+				t.Fatalf("NextRuns() error = %v", err)
+			}
+
+			var specTimes, launchdTimes []time.Time
+			for _, run := range runs {
+				if run.Before(until) {
+					specTimes = append(specTimes, run)
+				}
+			}
+			for ts := from; ts.Before(until); ts = ts.Add(time.Minute) {
+				if matchesAnyInterval(intervals, ts) {
+					launchdTimes = append(launchdTimes, ts)
+				}
+			}
+
+			if len(specTimes) != len(launchdTimes) {
+				t.Fatalf("cron spec fires %d times, launchd intervals fire %d times", len(specTimes), len(launchdTimes))
+			}
+			for i := range specTimes {
+				if !specTimes[i].Equal(launchdTimes[i]) {
+					t.Fatalf("fire %d: cron spec at %v, launchd at %v", i, specTimes[i], launchdTimes[i])
+				}
+			}
+		})
+	}
+}
+
+// matchesAnyInterval reports whether launchd would fire at t: every key set
+// in an interval must match, as described in launchd.plist(5).
+func matchesAnyInterval(intervals []CalendarInterval, t time.Time) bool {
+	for _, ci := range intervals {
+		if fieldMatches(ci.Minute, t.Minute()) &&
+			fieldMatches(ci.Hour, t.Hour()) &&
+			fieldMatches(ci.Day, t.Day()) &&
+			fieldMatches(ci.Weekday, int(t.Weekday())) &&
+			fieldMatches(ci.Month, int(t.Month())) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldMatches(field *int, v int) bool {
+	return field == nil || *field == v
+}
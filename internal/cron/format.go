@@ -0,0 +1,119 @@
+package cron
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FormatIntervals turns launchd calendar intervals back into a readable cron expression.
+// Intervals that form a full cartesian product collapse into a single expression;
+// anything else is rendered as one expression per interval, separated by "; ".
+func FormatIntervals(intervals []CalendarInterval) string {
+	if len(intervals) == 0 {
+		return ""
+	}
+
+	minutes := distinctField(intervals, func(ci CalendarInterval) *int { return ci.Minute })
+	hours := distinctField(intervals, func(ci CalendarInterval) *int { return ci.Hour })
+	days := distinctField(intervals, func(ci CalendarInterval) *int { return ci.Day })
+	months := distinctField(intervals, func(ci CalendarInterval) *int { return ci.Month })
+	weekdays := distinctField(intervals, func(ci CalendarInterval) *int { return ci.Weekday })
+
+	product := intervalCombinations(minutes, hours, days, weekdays, months)
+	if sameIntervals(product, intervals) {
+		return formatFields(minutes, hours, days, months, weekdays)
+	}
+
+	exprs := make([]string, len(intervals))
+	for i, ci := range intervals {
+		exprs[i] = formatFields(ptrSlice(ci.Minute), ptrSlice(ci.Hour), ptrSlice(ci.Day), ptrSlice(ci.Month), ptrSlice(ci.Weekday))
+	}
+	return strings.Join(exprs, "; ")
+}
+
+// distinctField returns the sorted distinct values of a field, or nil if any interval leaves it unset.
+func distinctField(intervals []CalendarInterval, field func(CalendarInterval) *int) []int {
+	var vals []int
+	for _, ci := range intervals {
+		v := field(ci)
+		if v == nil {
+			return nil
+		}
+		if !slices.Contains(vals, *v) {
+			vals = append(vals, *v)
+		}
+	}
+	slices.Sort(vals)
+	return vals
+}
+
+// sameIntervals reports whether a and b contain the same intervals, ignoring order.
+func sameIntervals(a, b []CalendarInterval) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		if !slices.ContainsFunc(b, func(y CalendarInterval) bool { return intervalEqual(x, y) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func intervalEqual(a, b CalendarInterval) bool {
+	return intPtrEqual(a.Minute, b.Minute) &&
+		intPtrEqual(a.Hour, b.Hour) &&
+		intPtrEqual(a.Day, b.Day) &&
+		intPtrEqual(a.Weekday, b.Weekday) &&
+		intPtrEqual(a.Month, b.Month)
+}
+
+func intPtrEqual(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func ptrSlice(v *int) []int {
+	if v == nil {
+		return nil
+	}
+	return []int{*v}
+}
+
+// formatFields renders field values as a five-field cron expression.
+func formatFields(minutes, hours, days, months, weekdays []int) string {
+	fields := make([]string, 0, 5)
+	for _, vals := range [][]int{minutes, hours, days, months, weekdays} {
+		fields = append(fields, formatField(vals))
+	}
+	return strings.Join(fields, " ")
+}
+
+// formatField renders sorted values as a comma list with runs of three or more
+// collapsed into ranges, or "*" for wildcards.
+// e.g., [1 2 3 4 5] → "1-5", [0 6 7] → "0,6,7"
+func formatField(vals []int) string {
+	if vals == nil {
+		return "*"
+	}
+	var parts []string
+	for i := 0; i < len(vals); {
+		j := i
+		for j+1 < len(vals) && vals[j+1] == vals[j]+1 {
+			j++
+		}
+		switch {
+		case j-i >= 2:
+			parts = append(parts, fmt.Sprintf("%d-%d", vals[i], vals[j]))
+		case j > i:
+			parts = append(parts, fmt.Sprint(vals[i]), fmt.Sprint(vals[j]))
+		default:
+			parts = append(parts, fmt.Sprint(vals[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,43 @@
+package cron
+
+import (
+	"testing"
+)
+
+func TestFormatIntervalsRoundTrip(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 0 * * *", "0 0 * * *"},
+		{"0 6,18 * * *", "0 6,18 * * *"},
+		{"0 9 * * 1-5", "0 9 * * 1-5"},
+		{"30 14 15 * *", "30 14 15 * *"},
+		{"0,30 9,18 * * *", "0,30 9,18 * * *"},
+		{"0 8-10,12 * * 0,6", "0 8-10,12 * * 0,6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			intervals, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			if got := FormatIntervals(intervals); got != tt.want {
+				t.Errorf("FormatIntervals() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatIntervalsIrregular(t *testing.T) {
+	intervals := []CalendarInterval{
+		{Minute: intPtr(0), Hour: intPtr(2)},
+		{Minute: intPtr(30), Hour: intPtr(14)},
+	}
+
+	want := "0 2 * * *; 30 14 * * *"
+	if got := FormatIntervals(intervals); got != want {
+		t.Errorf("FormatIntervals() = %q, want %q", got, want)
+	}
+}
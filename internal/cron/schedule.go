@@ -0,0 +1,191 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// parser accepts five-field expressions, descriptors (@daily, @every 6h)
+// and CRON_TZ=/TZ= prefixes.
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule is a parsed schedule expression.
+// Exactly one of Spec and Every is set.
+type Schedule struct {
+	Expr string
+	// Spec holds the calendar fields, in the expression's location
+	Spec *cron.SpecSchedule
+	// Every is the interval of an "@every <duration>" expression
+	Every time.Duration
+}
+
+// Parse parses a cron expression, descriptor or "@every" interval.
+func Parse(expr string) (*Schedule, error) {
+	parsed, err := parser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	// Type assert to access the parsed bit fields directly.
+	// SpecSchedule stores each cron field as a uint64 bit set.
+	switch s := parsed.(type) {
+	case *cron.SpecSchedule:
+		return &Schedule{Expr: expr, Spec: s}, nil
+	case cron.ConstantDelaySchedule:
+		return &Schedule{Expr: expr, Every: s.Delay}, nil
+	default:
+		return nil, fmt.Errorf("unexpected schedule type")
+	}
+}
+
+// Next returns the next fire time after t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Spec != nil {
+		return s.Spec.Next(t)
+	}
+	return t.Add(s.Every)
+}
+
+// HasTimezone reports whether the expression carries a CRON_TZ=/TZ= prefix.
+func (s *Schedule) HasTimezone() bool {
+	return s.Spec != nil && s.Spec.Location != time.Local
+}
+
+// Intervals returns launchd calendar intervals, shifted into local time.
+func (s *Schedule) Intervals() ([]CalendarInterval, error) {
+	if s.Spec == nil {
+		return nil, fmt.Errorf("%q is a fixed interval, not a calendar schedule", s.Expr)
+	}
+
+	spec, err := s.LocalSpec()
+	if err != nil {
+		return nil, err
+	}
+	return expandSpec(spec)
+}
+
+// OnCalendar returns systemd OnCalendar values. systemd understands
+// timezones natively, so the expression's zone is appended instead of shifting.
+func (s *Schedule) OnCalendar() ([]string, error) {
+	if s.Spec == nil {
+		return nil, fmt.Errorf("%q is a fixed interval, not a calendar schedule", s.Expr)
+	}
+
+	calendars, err := onCalendarSpec(s.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if s.HasTimezone() {
+		for i := range calendars {
+			calendars[i] += " " + s.Spec.Location.String()
+		}
+	}
+	return calendars, nil
+}
+
+// CronExpr returns an equivalent five-field expression in local time, for
+// crontabs that understand neither descriptors nor timezones.
+// Intervals are only supported when they divide an hour or a day evenly.
+func (s *Schedule) CronExpr() (string, error) {
+	if s.Spec == nil {
+		switch {
+		case s.Every <= 0 || s.Every%time.Minute != 0:
+			return "", fmt.Errorf("%q: interval must be a whole number of minutes", s.Expr)
+		case s.Every < time.Hour && time.Hour%s.Every == 0:
+			return fmt.Sprintf("*/%d * * * *", int(s.Every/time.Minute)), nil
+		case s.Every == 24*time.Hour:
+			return "0 0 * * *", nil
+		case s.Every%time.Hour == 0 && (24*time.Hour)%s.Every == 0:
+			return fmt.Sprintf("0 */%d * * *", int(s.Every/time.Hour)), nil
+		default:
+			return "", fmt.Errorf("%q: interval must divide an hour or a day evenly", s.Expr)
+		}
+	}
+
+	spec, err := s.LocalSpec()
+	if err != nil {
+		return "", err
+	}
+	return formatFields(
+		bitsToSlice(spec.Minute, 0, 59),
+		bitsToSlice(spec.Hour, 0, 23),
+		bitsToSlice(spec.Dom, 1, 31),
+		bitsToSlice(spec.Month, 1, 12),
+		bitsToSlice(spec.Dow, 0, 6),
+	), nil
+}
+
+// LocalSpec returns the calendar fields shifted from the expression's
+// timezone into the machine's local zone.
+//
+// Only whole-hour shifts that stay constant all year (no DST mismatch) are
+// supported, and a shift may only wrap past midnight when no day or month
+// field is restricted.
+func (s *Schedule) LocalSpec() (*cron.SpecSchedule, error) {
+	if !s.HasTimezone() {
+		return s.Spec, nil
+	}
+
+	loc := s.Spec.Location
+	shift, err := zoneShift(loc, time.Local, time.Now().Year())
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", s.Expr, err)
+	}
+	if shift%time.Hour != 0 {
+		return nil, fmt.Errorf("%q: %s is %v from local time, only whole-hour differences can be converted", s.Expr, loc, shift)
+	}
+	hoursShift := int(shift / time.Hour)
+
+	dayRestricted := bitsToSlice(s.Spec.Dom, 1, 31) != nil ||
+		bitsToSlice(s.Spec.Month, 1, 12) != nil ||
+		bitsToSlice(s.Spec.Dow, 0, 6) != nil
+
+	var hourBits uint64
+	for h := 0; h <= 23; h++ {
+		if s.Spec.Hour&(1<<uint(h)) == 0 {
+			continue
+		}
+		shifted := h + hoursShift
+		if (shifted < 0 || shifted > 23) && dayRestricted {
+			return nil, fmt.Errorf("%q: converting from %s to local time crosses midnight, which changes the day fields; use local time instead", s.Expr, loc)
+		}
+		hourBits |= 1 << uint((shifted+24)%24)
+	}
+
+	local := *s.Spec
+	local.Hour = hourBits | s.Spec.Hour&starBit
+	local.Location = time.Local
+	return &local, nil
+}
+
+// starBit marks a field that was given as "*" (see robfig/cron SpecSchedule).
+const starBit = 1 << 63
+
+// zoneShift returns how far local clocks are ahead of from's, checking
+// that the difference is the same in winter and summer.
+func zoneShift(from, to *time.Location, year int) (time.Duration, error) {
+	var shift time.Duration
+	for i, month := range []time.Month{time.January, time.July} {
+		t := time.Date(year, month, 1, 12, 0, 0, 0, time.UTC)
+		_, fromOffset := t.In(from).Zone()
+		_, toOffset := t.In(to).Zone()
+		d := time.Duration(toOffset-fromOffset) * time.Second
+		if i > 0 && d != shift {
+			return 0, fmt.Errorf("the offset between %s and local time changes with daylight saving time; use local time instead", from)
+		}
+		shift = d
+	}
+	return shift, nil
+}
+
+// Missed reports whether a fire time passed between lastSuccess and now
+// without a successful run. A zero lastSuccess (never ran) is not a miss.
+func (s *Schedule) Missed(lastSuccess, now time.Time) bool {
+	if lastSuccess.IsZero() {
+		return false
+	}
+	next := s.Next(lastSuccess)
+	return !next.IsZero() && !next.After(now)
+}
@@ -0,0 +1,184 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// withLocal runs the test with time.Local set to loc.
+func withLocal(t *testing.T, loc *time.Location) {
+	t.Helper()
+	orig := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = orig })
+}
+
+func TestParseDescriptors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"@hourly", "0 * * * *"},
+		{"@daily", "0 0 * * *"},
+		{"@midnight", "0 0 * * *"},
+		{"@weekly", "0 0 * * 0"},
+		{"@monthly", "0 0 1 * *"},
+		{"@yearly", "0 0 1 1 *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := schedule.CronExpr()
+			if err != nil {
+				t.Fatalf("CronExpr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CronExpr() = %q, want %q", got, tt.want)
+			}
+			if _, err := schedule.Intervals(); err != nil {
+				t.Errorf("Intervals() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseEvery(t *testing.T) {
+	tests := []struct {
+		expr    string
+		every   time.Duration
+		cron    string
+		cronErr bool
+	}{
+		{"@every 15m", 15 * time.Minute, "*/15 * * * *", false},
+		{"@every 6h", 6 * time.Hour, "0 */6 * * *", false},
+		{"@every 24h", 24 * time.Hour, "0 0 * * *", false},
+		{"@every 7h", 7 * time.Hour, "", true},
+		{"@every 90s", 90 * time.Second, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if schedule.Every != tt.every {
+				t.Errorf("Every = %v, want %v", schedule.Every, tt.every)
+			}
+			if _, err := schedule.Intervals(); err == nil {
+				t.Error("Intervals() expected error for fixed interval")
+			}
+
+			got, err := schedule.CronExpr()
+			if tt.cronErr {
+				if err == nil {
+					t.Errorf("CronExpr() = %q, expected error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.cron {
+				t.Errorf("CronExpr() = %q, %v, want %q", got, err, tt.cron)
+			}
+		})
+	}
+}
+
+func TestTimezoneShift(t *testing.T) {
+	withLocal(t, time.FixedZone("UTC+1", 3600))
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"no prefix", "0 2 * * *", "0 2 * * *"},
+		{"behind local", "CRON_TZ=Asia/Bangkok 0 9 * * *", "0 3 * * *"},
+		{"TZ prefix", "TZ=Asia/Tokyo 30 12 * * 1-5", "30 4 * * 1-5"},
+		{"wraps without day fields", "CRON_TZ=Asia/Bangkok 0 2 * * *", "0 20 * * *"},
+		{"descriptor", "CRON_TZ=Asia/Bangkok @daily", "0 18 * * *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := schedule.CronExpr()
+			if err != nil {
+				t.Fatalf("CronExpr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CronExpr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimezoneShiftRejected(t *testing.T) {
+	withLocal(t, time.FixedZone("UTC+1", 3600))
+
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"crosses midnight with weekday", "CRON_TZ=Asia/Bangkok 0 2 * * 1"},
+		{"half-hour offset", "CRON_TZ=Asia/Kolkata 0 9 * * *"},
+		{"daylight saving time", "CRON_TZ=Europe/Berlin 0 9 * * *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if _, err := schedule.Intervals(); err == nil {
+				t.Error("Intervals() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestOnCalendarTimezone(t *testing.T) {
+	got, err := ParseOnCalendar("CRON_TZ=Europe/Berlin 0 9 * * 1")
+	if err != nil {
+		t.Fatalf("ParseOnCalendar() error = %v", err)
+	}
+	want := "Mon *-*-* 09:00:00 Europe/Berlin"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("ParseOnCalendar() = %q, want %q", got, want)
+	}
+}
+
+func TestMissed(t *testing.T) {
+	schedule, err := Parse("0 2 * * *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	lastSuccess := time.Date(2026, 3, 1, 2, 40, 0, 0, time.Local)
+
+	tests := []struct {
+		name        string
+		lastSuccess time.Time
+		now         time.Time
+		want        bool
+	}{
+		{"before next fire", lastSuccess, time.Date(2026, 3, 2, 1, 59, 0, 0, time.Local), false},
+		{"asleep through next fire", lastSuccess, time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local), true},
+		{"never ran", time.Time{}, time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.Missed(tt.lastSuccess, tt.now); got != tt.want {
+				t.Errorf("Missed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+var weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// ParseOnCalendar parses a cron expression and returns systemd OnCalendar values.
+// See: https://www.freedesktop.org/software/systemd/man/systemd.time.html
+func ParseOnCalendar(expr string) ([]string, error) {
+	schedule, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule.OnCalendar()
+}
+
+// onCalendarSpec converts a SpecSchedule into OnCalendar values.
+// Unlike launchd, systemd accepts lists in each field, so no expansion is needed.
+func onCalendarSpec(spec *cron.SpecSchedule) ([]string, error) {
+	minutes := bitsToSlice(spec.Minute, 0, 59)
+	hours := bitsToSlice(spec.Hour, 0, 23)
+	days := bitsToSlice(spec.Dom, 1, 31)
+	months := bitsToSlice(spec.Month, 1, 12)
+	weekdays := bitsToSlice(spec.Dow, 0, 6)
+
+	if minutes == nil && hours == nil && days == nil && months == nil && weekdays == nil {
+		return nil, fmt.Errorf("cron expression is all wildcards")
+	}
+
+	// Cron fires when either day-of-month or day-of-week matches if both are
+	// restricted, while systemd requires both. Emit one entry for each instead.
+	if days != nil && weekdays != nil {
+		return []string{
+			onCalendarEntry(minutes, hours, days, months, nil),
+			onCalendarEntry(minutes, hours, nil, months, weekdays),
+		}, nil
+	}
+
+	return []string{onCalendarEntry(minutes, hours, days, months, weekdays)}, nil
+}
+
+// onCalendarEntry formats a single "DOW *-MM-DD HH:MM:00" calendar event.
+// nil slices are treated as wildcards.
+func onCalendarEntry(minutes, hours, days, months, weekdays []int) string {
+	date := fmt.Sprintf("*-%s-%s", joinField(months), joinField(days))
+	clock := fmt.Sprintf("%s:%s:00", joinField(hours), joinField(minutes))
+
+	if weekdays == nil {
+		return date + " " + clock
+	}
+
+	names := make([]string, len(weekdays))
+	for i, w := range weekdays {
+		names[i] = weekdayNames[w]
+	}
+	return strings.Join(names, ",") + " " + date + " " + clock
+}
+
+// joinField formats field values as a zero-padded comma list, or "*" for wildcards.
+func joinField(vals []int) string {
+	if vals == nil {
+		return "*"
+	}
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = fmt.Sprintf("%02d", v)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"testing"
+)
+
+func TestParseOnCalendar(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{"daily at 2am", "0 2 * * *", []string{"*-*-* 02:00:00"}},
+		{"twice daily", "0 6,18 * * *", []string{"*-*-* 06,18:00:00"}},
+		{"weekdays at 9am", "0 9 * * 1-5", []string{"Mon,Tue,Wed,Thu,Fri *-*-* 09:00:00"}},
+		{"monthly on the 15th", "30 14 15 * *", []string{"*-*-15 14:30:00"}},
+		{"every minute in january", "* * * 1 *", []string{"*-01-* *:*:00"}},
+		{
+			"day of month or weekday",
+			"0 3 1 * 0",
+			[]string{"*-*-01 03:00:00", "Sun *-*-* 03:00:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOnCalendar(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseOnCalendar() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseOnCalendar() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseOnCalendar()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseOnCalendarInvalid(t *testing.T) {
+	for _, expr := range []string{"invalid", "", "* * * * *"} {
+		if _, err := ParseOnCalendar(expr); err == nil {
+			t.Errorf("ParseOnCalendar(%q) expected error, got nil", expr)
+		}
+	}
+}
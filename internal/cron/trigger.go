@@ -0,0 +1,111 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Trigger describes how launchd should fire a schedule.
+// Exactly one of Intervals and StartInterval is set.
+type Trigger struct {
+	Intervals     []CalendarInterval
+	StartInterval time.Duration
+	// Gated means the trigger fires more often than the schedule, so the job
+	// has to skip the runs the schedule does not match (see LastFire).
+	Gated bool
+}
+
+// LaunchdTrigger picks launchd triggers for a schedule. Calendar intervals are
+// preferred; when they would exceed MaxScheduleEntries, regular intervals
+// without day restrictions become a StartInterval, and anything else becomes a
+// coarser calendar trigger that is gated on the full schedule.
+func (s *Schedule) LaunchdTrigger() (*Trigger, error) {
+	if s.Spec == nil {
+		return &Trigger{StartInterval: s.Every}, nil
+	}
+
+	spec, err := s.LocalSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	intervals, err := expandSpec(spec)
+	if err == nil {
+		return &Trigger{Intervals: intervals}, nil
+	}
+
+	minutes := bitsToSlice(spec.Minute, 0, 59)
+	hours := bitsToSlice(spec.Hour, 0, 23)
+	days := bitsToSlice(spec.Dom, 1, 31)
+	months := bitsToSlice(spec.Month, 1, 12)
+	weekdays := bitsToSlice(spec.Dow, 0, 6)
+
+	if days == nil && months == nil && weekdays == nil {
+		if period, ok := regularPeriod(spec); ok {
+			return &Trigger{StartInterval: period}, nil
+		}
+	}
+
+	// Drop the day fields, then the hours, until the trigger fits.
+	// The gate restores whatever was dropped.
+	for _, fields := range [][][]int{{minutes, hours}, {minutes, nil}} {
+		if count := max(1, len(fields[0])) * max(1, len(fields[1])); count <= MaxScheduleEntries {
+			return &Trigger{
+				Intervals: intervalCombinations(fields[0], fields[1], nil, nil, nil),
+				Gated:     true,
+			}, nil
+		}
+	}
+
+	return nil, err
+}
+
+// regularPeriod reports whether the fire times within a day are evenly
+// spaced (wrapping around midnight), and returns the spacing.
+func regularPeriod(spec *cron.SpecSchedule) (time.Duration, bool) {
+	var fires []int
+	for h := 0; h <= 23; h++ {
+		if spec.Hour&(1<<uint(h)) == 0 {
+			continue
+		}
+		for m := 0; m <= 59; m++ {
+			if spec.Minute&(1<<uint(m)) != 0 {
+				fires = append(fires, h*60+m)
+			}
+		}
+	}
+	if len(fires) < 2 {
+		return 0, false
+	}
+
+	const minutesPerDay = 24 * 60
+	period := fires[1] - fires[0]
+	if minutesPerDay%period != 0 || len(fires) != minutesPerDay/period {
+		return 0, false
+	}
+	for i := 1; i < len(fires); i++ {
+		if fires[i]-fires[i-1] != period {
+			return 0, false
+		}
+	}
+	return time.Duration(period) * time.Minute, true
+}
+
+// LastFire returns the latest time a cron expression fired within window
+// before t (inclusive of t). ok is false if it did not fire in the window.
+func LastFire(expr string, t time.Time, window time.Duration) (last time.Time, ok bool, err error) {
+	schedule, err := Parse(expr)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if schedule.Spec == nil {
+		return time.Time{}, false, fmt.Errorf("%q is a fixed interval, not a calendar schedule", expr)
+	}
+
+	for next := schedule.Next(t.Add(-window)); !next.After(t); next = schedule.Next(next) {
+		last, ok = next, true
+	}
+	return last, ok, nil
+}
@@ -0,0 +1,110 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLaunchdTrigger(t *testing.T) {
+	tests := []struct {
+		name          string
+		expr          string
+		intervals     int
+		startInterval time.Duration
+		gated         bool
+	}{
+		{"fits the cap", "0 9 * * 1-5", 5, 0, false},
+		{"every minute", "* * * * *", 0, time.Minute, false},
+		{"every two minutes fits the cap", "*/2 * * * *", 30, 0, false},
+		{"regular minute list", "0-59 * * * *", 0, time.Minute, false},
+		{"fixed interval", "@every 90m", 0, 90 * time.Minute, false},
+		{"working hours", "*/5 9-17 * * 1-5", 12, 0, true},
+		{"busy minutes", "*/2 9-17 * * *", 30, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			trigger, err := schedule.LaunchdTrigger()
+			if err != nil {
+				t.Fatalf("LaunchdTrigger() error = %v", err)
+			}
+			if len(trigger.Intervals) != tt.intervals || trigger.StartInterval != tt.startInterval || trigger.Gated != tt.gated {
+				t.Errorf("LaunchdTrigger() = %d intervals, StartInterval %v, gated %v; want %d, %v, %v",
+					len(trigger.Intervals), trigger.StartInterval, trigger.Gated, tt.intervals, tt.startInterval, tt.gated)
+			}
+		})
+	}
+}
+
+func TestLaunchdTriggerLastResort(t *testing.T) {
+	schedule, err := Parse("0-54 9 * * 1")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, err := schedule.LaunchdTrigger(); err == nil {
+		t.Error("LaunchdTrigger() expected error when even minutes alone exceed the cap")
+	}
+}
+
+// TestGatedTriggerCoversSchedule checks that a gated trigger fires at every
+// time the schedule does, so the gate never misses a run.
+func TestGatedTriggerCoversSchedule(t *testing.T) {
+	expr := "*/5 9-17 * * 1-5"
+	schedule, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	trigger, err := schedule.LaunchdTrigger()
+	if err != nil {
+		t.Fatalf("LaunchdTrigger() error = %v", err)
+	}
+
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)
+	for ts := from; ts.Before(from.AddDate(0, 0, 14)); ts = ts.Add(time.Minute) {
+		last, ok, err := LastFire(expr, ts, time.Minute)
+		if err != nil {
+			t.Fatalf("LastFire() error = %v", err)
+		}
+		if ok && last.Equal(ts) && !matchesAnyInterval(trigger.Intervals, ts) {
+			t.Fatalf("schedule fires at %v but the trigger does not", ts)
+		}
+	}
+}
+
+func TestLastFire(t *testing.T) {
+	monday905 := time.Date(2026, 3, 2, 9, 5, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		expr   string
+		t      time.Time
+		window time.Duration
+		want   time.Time
+		ok     bool
+	}{
+		{"on time", "*/5 9-17 * * 1-5", monday905.Add(30 * time.Second), time.Hour, monday905, true},
+		{"late", "*/5 9-17 * * 1-5", monday905.Add(3 * time.Minute), time.Hour, monday905, true},
+		{"latest of several", "*/5 9-17 * * 1-5", monday905.Add(12 * time.Minute), time.Hour, monday905.Add(10 * time.Minute), true},
+		{"outside the window", "*/5 9-17 * * 1-5", monday905.Add(3 * time.Minute), time.Minute, time.Time{}, false},
+		{"weekend", "*/5 9-17 * * 1-5", monday905.AddDate(0, 0, 5), time.Hour, time.Time{}, false},
+		{"exactly at the start of the window", "0 2 * * *", time.Date(2026, 3, 2, 3, 0, 0, 0, time.Local), time.Hour, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok, err := LastFire(tt.expr, tt.t, tt.window)
+		if err != nil {
+			t.Fatalf("%s: LastFire() error = %v", tt.name, err)
+		}
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("%s: LastFire(%q, %v, %v) = %v, %v; want %v, %v", tt.name, tt.expr, tt.t, tt.window, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if _, _, err := LastFire("@every 1h", monday905, time.Hour); err == nil {
+		t.Error("LastFire() expected error for a fixed interval")
+	}
+}
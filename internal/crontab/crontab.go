@@ -0,0 +1,295 @@
+package crontab
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+)
+
+const (
+	markerPrefix = "# restic-helpers:"
+	beginSuffix  = " BEGIN"
+	endSuffix    = " END"
+	location     = "user crontab"
+)
+
+// jobLinePattern matches the job line written by CreateBlock, capturing the
+// schedule and the stdout/stderr log paths
+var jobLinePattern = regexp.MustCompile(`^(\S+ \S+ \S+ \S+ \S+) .* >> ('(?:[^']|'\\'')*') 2>> ('(?:[^']|'\\'')*')$`)
+
+// Scheduler installs jobs as tagged blocks in the user's crontab
+type Scheduler struct {
+	Run scheduler.Runner
+}
+
+// NewScheduler returns a Scheduler that manages the crontab with the crontab command
+func NewScheduler() (*Scheduler, error) {
+	return &Scheduler{Run: scheduler.ExecRunner}, nil
+}
+
+// Name returns the backend name
+func (s *Scheduler) Name() string {
+	return "crontab"
+}
+
+// CreateBlock builds the tagged crontab block for a spec
+func CreateBlock(spec scheduler.Spec) (string, error) {
+	paths, err := config.GetPaths()
+	if err != nil {
+		return "", err
+	}
+
+	// Not every cron implementation understands descriptors or CRON_TZ,
+	// so always write a plain five-field expression in local time
+	schedule, err := cron.Parse(spec.Schedule)
+	if err != nil {
+		return "", err
+	}
+	localExpr, err := schedule.CronExpr()
+	if err != nil {
+		return "", err
+	}
+
+	stdoutPath := filepath.Join(paths.StateDir, spec.Name()+".out.log")
+	stderrPath := filepath.Join(paths.StateDir, spec.Name()+".err.log")
+	redirect := fmt.Sprintf(">> %s 2>> %s", shellQuote(stdoutPath), shellQuote(stderrPath))
+
+	// Environment variables are assigned in front of the command
+	var env string
+	for _, key := range spec.EnvKeys() {
+		env += key + "=" + shellQuote(spec.Env[key]) + " "
+	}
+
+	regular := spec
+	regular.CatchUp = false
+	lines := []string{
+		markerPrefix + spec.Name() + beginSuffix,
+		fmt.Sprintf("%s %s%s %s", localExpr, env, shellCommand(regular.Command(false)), redirect),
+	}
+
+	// The regular line already runs on time; @reboot only has to catch up
+	if spec.CatchUp {
+		lines = append(lines, fmt.Sprintf("@reboot %s%s %s", env, shellCommand(spec.Command(false)), redirect))
+	}
+
+	lines = append(lines, markerPrefix+spec.Name()+endSuffix)
+
+	// cron treats an unescaped % in the command as a newline
+	for i := range lines {
+		lines[i] = strings.ReplaceAll(lines[i], "%", `\%`)
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// shellCommand joins a command line for /bin/sh. The subcommand and flags are
+// left bare; the binary, repository and flag values are quoted.
+func shellCommand(args []string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		if i == 1 || strings.HasPrefix(arg, "--") {
+			words[i] = arg
+		} else {
+			words[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Create builds the crontab block for a spec
+func (s *Scheduler) Create(spec scheduler.Spec) (*scheduler.Job, error) {
+	block, err := CreateBlock(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Job{
+		Spec: spec,
+		Files: []scheduler.File{
+			{Kind: "crontab block", Path: location, Content: block},
+		},
+		Summary: "Created crontab block",
+	}, nil
+}
+
+// Install replaces the job's block in the crontab, or appends it
+func (s *Scheduler) Install(job *scheduler.Job) error {
+	current, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	updated, _ := removeBlock(current, job.Spec.Name())
+	if updated != "" && !strings.HasSuffix(updated, "\n") {
+		updated += "\n"
+	}
+	updated += job.Files[0].Content
+
+	return s.write(updated)
+}
+
+// Uninstall removes the job's block and leaves all other lines alone
+func (s *Scheduler) Uninstall(name string) error {
+	current, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	updated, found := removeBlock(current, name)
+	if !found {
+		return scheduler.ErrNotScheduled
+	}
+
+	return s.write(updated)
+}
+
+// List returns all restic-helpers blocks in the crontab
+func (s *Scheduler) List() ([]scheduler.Entry, error) {
+	current, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []scheduler.Entry
+	for _, line := range strings.Split(current, "\n") {
+		if name, ok := parseMarker(line, beginSuffix); ok {
+			block, _ := findBlock(current, name)
+			entries = append(entries, s.entry(name, block))
+		}
+	}
+	return entries, nil
+}
+
+// Status returns the crontab block with the given job name
+func (s *Scheduler) Status(name string) (*scheduler.Entry, error) {
+	current, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	block, found := findBlock(current, name)
+	if !found {
+		return nil, scheduler.ErrNotScheduled
+	}
+
+	entry := s.entry(name, block)
+	return &entry, nil
+}
+
+// entry builds an Entry from a block, parsing the schedule and log paths from its job line.
+// Cron keeps no exit status, so LastExitStatus is left unset.
+func (s *Scheduler) entry(name, block string) scheduler.Entry {
+	repoName, task := scheduler.ParseJobName(name)
+	entry := scheduler.Entry{
+		Repo:    repoName,
+		Task:    task,
+		Backend: s.Name(),
+		Loaded:  true,
+		Files: []scheduler.File{
+			{Kind: "crontab block", Path: location, Content: block},
+		},
+	}
+
+	// The first job line is the regular schedule; an @reboot line may follow
+	for _, line := range strings.Split(block, "\n") {
+		if m := jobLinePattern.FindStringSubmatch(line); m != nil {
+			entry.Schedule = m[1]
+			entry.StdoutPath = shellUnquote(m[2])
+			entry.StderrPath = shellUnquote(m[3])
+			break
+		}
+	}
+
+	return entry
+}
+
+// read returns the current crontab, treating "no crontab for user" as empty
+func (s *Scheduler) read() (string, error) {
+	out, err := s.Run(nil, "crontab", "-l")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "no crontab") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read crontab: %w", err)
+	}
+	return string(out), nil
+}
+
+// write replaces the crontab with content
+func (s *Scheduler) write(content string) error {
+	if _, err := s.Run([]byte(content), "crontab", "-"); err != nil {
+		return fmt.Errorf("failed to write crontab: %w", err)
+	}
+	return nil
+}
+
+// findBlock returns the tagged block for a job name, including its markers
+func findBlock(content, name string) (string, bool) {
+	var block []string
+	inBlock := false
+	for _, line := range strings.Split(content, "\n") {
+		if isMarker(line, name, beginSuffix) {
+			inBlock = true
+		}
+		if inBlock {
+			block = append(block, line)
+		}
+		if inBlock && isMarker(line, name, endSuffix) {
+			return strings.Join(block, "\n") + "\n", true
+		}
+	}
+	return "", false
+}
+
+// removeBlock removes the tagged block for a job name and reports whether it was found
+func removeBlock(content, name string) (string, bool) {
+	lines := strings.SplitAfter(content, "\n")
+	kept := make([]string, 0, len(lines))
+	inBlock, found := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimRight(line, "\n")
+		switch {
+		case isMarker(trimmed, name, beginSuffix):
+			inBlock, found = true, true
+		case inBlock && isMarker(trimmed, name, endSuffix):
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, ""), found
+}
+
+// isMarker reports whether line is the begin or end marker for a job name
+func isMarker(line, name, suffix string) bool {
+	return strings.TrimSpace(line) == markerPrefix+name+suffix
+}
+
+// parseMarker extracts the job name from a begin or end marker line
+func parseMarker(line, suffix string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, markerPrefix) || !strings.HasSuffix(line, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(line, markerPrefix), suffix), true
+}
+
+// shellUnquote reverses shellQuote, including the cron % escaping
+func shellUnquote(s string) string {
+	s = strings.ReplaceAll(s, `\%`, "%")
+	s = strings.ReplaceAll(s, `'\''`, "'")
+	return strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'")
+}
+
+// shellQuote single-quotes a string for /bin/sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,180 @@
+package crontab
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+)
+
+// fakeCrontab is a stub scheduler.Runner backed by an in-memory crontab.
+type fakeCrontab struct {
+	content string
+}
+
+func (f *fakeCrontab) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	if name != "crontab" || len(args) != 1 {
+		return nil, errors.New("unexpected command")
+	}
+	switch args[0] {
+	case "-l":
+		return []byte(f.content), nil
+	case "-":
+		f.content = string(stdin)
+		return nil, nil
+	}
+	return nil, errors.New("unexpected argument")
+}
+
+func newTestScheduler(t *testing.T, content string) (*Scheduler, *fakeCrontab) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	fake := &fakeCrontab{content: content}
+	return &Scheduler{Run: fake.run}, fake
+}
+
+func install(t *testing.T, s *Scheduler, repoName, expr string) {
+	t.Helper()
+	job, err := s.Create(scheduler.Spec{Repo: repoName, Schedule: expr, Binary: "/usr/local/bin/restic-helpers"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+}
+
+func TestInstallKeepsUserLines(t *testing.T) {
+	userLines := "MAILTO=me@example.com\n*/10 * * * * /usr/bin/sync-mail\n"
+	s, fake := newTestScheduler(t, userLines)
+
+	install(t, s, "laptop", "0 2 * * *")
+
+	if !strings.HasPrefix(fake.content, userLines) {
+		t.Errorf("user lines not preserved:\n%s", fake.content)
+	}
+	if !strings.Contains(fake.content, "# restic-helpers:laptop BEGIN\n0 2 * * * '/usr/local/bin/restic-helpers' backup 'laptop' --scheduled >> ") {
+		t.Errorf("block not installed:\n%s", fake.content)
+	}
+
+	entry, err := s.Status("laptop")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if entry.Schedule != "0 2 * * *" {
+		t.Errorf("Schedule = %q, want %q", entry.Schedule, "0 2 * * *")
+	}
+	if !strings.HasSuffix(entry.StdoutPath, "laptop.out.log") || !strings.HasSuffix(entry.StderrPath, "laptop.err.log") {
+		t.Errorf("log paths = %q, %q", entry.StdoutPath, entry.StderrPath)
+	}
+}
+
+func TestInstallReplacesBlock(t *testing.T) {
+	s, fake := newTestScheduler(t, "")
+
+	install(t, s, "laptop", "0 2 * * *")
+	install(t, s, "photos", "0 3 * * *")
+	install(t, s, "laptop", "30 4 * * *")
+
+	if strings.Count(fake.content, "# restic-helpers:laptop BEGIN") != 1 {
+		t.Errorf("expected exactly one laptop block:\n%s", fake.content)
+	}
+	if strings.Contains(fake.content, "0 2 * * *") {
+		t.Errorf("old laptop schedule not replaced:\n%s", fake.content)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Repo != "photos" || entries[1].Repo != "laptop" {
+		t.Errorf("List() = %+v, want photos and laptop", entries)
+	}
+}
+
+func TestUninstallRemovesOnlyBlock(t *testing.T) {
+	userLines := "# my jobs\n*/10 * * * * /usr/bin/sync-mail\n"
+	s, fake := newTestScheduler(t, userLines)
+
+	install(t, s, "laptop", "0 2 * * *")
+	if err := s.Uninstall("laptop"); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+
+	if fake.content != userLines {
+		t.Errorf("crontab after Uninstall() = %q, want %q", fake.content, userLines)
+	}
+	if err := s.Uninstall("laptop"); !errors.Is(err, scheduler.ErrNotScheduled) {
+		t.Errorf("second Uninstall() error = %v, want ErrNotScheduled", err)
+	}
+	if _, err := s.Status("laptop"); !errors.Is(err, scheduler.ErrNotScheduled) {
+		t.Errorf("Status() error = %v, want ErrNotScheduled", err)
+	}
+}
+
+func TestCreateBlockCatchUp(t *testing.T) {
+	s, _ := newTestScheduler(t, "")
+
+	block, err := CreateBlock(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/usr/local/bin/restic-helpers", CatchUp: true})
+	if err != nil {
+		t.Fatalf("CreateBlock() error = %v", err)
+	}
+	if !strings.Contains(block, "\n@reboot '/usr/local/bin/restic-helpers' backup 'laptop' --scheduled --when '0 2 * * *' --catch-up >> ") {
+		t.Errorf("@reboot line missing:\n%s", block)
+	}
+
+	entry := s.entry("laptop", block)
+	if entry.Schedule != "0 2 * * *" {
+		t.Errorf("Schedule = %q, want the regular line's schedule", entry.Schedule)
+	}
+}
+
+func TestInstallSeparateTasks(t *testing.T) {
+	s, fake := newTestScheduler(t, "")
+
+	install(t, s, "laptop", "0 2 * * *")
+	job, err := s.Create(scheduler.Spec{Repo: "laptop", Schedule: "0 5 * * 0", Binary: "/usr/local/bin/restic-helpers", Task: scheduler.TaskPrune})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	if !strings.Contains(fake.content, "# restic-helpers:laptop.prune BEGIN\n0 5 * * 0 '/usr/local/bin/restic-helpers' prune 'laptop' --skip >> ") {
+		t.Errorf("prune block not installed:\n%s", fake.content)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 2 || entries[1].Repo != "laptop" || entries[1].Task != scheduler.TaskPrune {
+		t.Errorf("List() = %+v, want laptop backup and prune", entries)
+	}
+
+	if err := s.Uninstall("laptop.prune"); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if entry, err := s.Status("laptop"); err != nil || entry.Task != scheduler.TaskBackup {
+		t.Errorf("Status() = %+v, %v, want the backup job to remain", entry, err)
+	}
+}
+
+func TestCreateBlockEnvironment(t *testing.T) {
+	s, _ := newTestScheduler(t, "")
+
+	block, err := CreateBlock(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/usr/local/bin/restic-helpers", Env: map[string]string{"XDG_STATE_HOME": "/srv/it's"}})
+	if err != nil {
+		t.Fatalf("CreateBlock() error = %v", err)
+	}
+	if !strings.Contains(block, "\n0 2 * * * XDG_STATE_HOME='/srv/it'\\''s' '/usr/local/bin/restic-helpers' backup 'laptop' --scheduled >> ") {
+		t.Errorf("job line has no environment:\n%s", block)
+	}
+
+	entry := s.entry("laptop", block)
+	if entry.Schedule != "0 2 * * *" {
+		t.Errorf("Schedule = %q", entry.Schedule)
+	}
+}
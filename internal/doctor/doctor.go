@@ -0,0 +1,440 @@
+// Package doctor checks the configuration for problems that would otherwise
+// only show up when a scheduled backup fails.
+package doctor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/catflyflyfly/restic-helpers/internal/assets"
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/catflyflyfly/restic-helpers/internal/secrets"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// GlobalScope is the scope of checks that are not about one repository
+const GlobalScope = "global"
+
+// MinResticVersion is the oldest restic that understands every flag we pass
+// (the keep-within-* forget options arrived in 0.13.0)
+var MinResticVersion = [3]int{0, 13, 0}
+
+// resticVersionPattern matches the version in the output of `restic version`
+var resticVersionPattern = regexp.MustCompile(`restic (\d+)\.(\d+)\.(\d+)`)
+
+// Result is the outcome of one check
+type Result struct {
+	// Scope is GlobalScope or a repository name
+	Scope   string `json:"scope"`
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	// Hint says how to fix a warning or failure
+	Hint string `json:"hint,omitempty"`
+}
+
+// Report holds the results of a run, in the order they were checked
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Count returns the number of results with a status
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	return r.Count(Fail) > 0
+}
+
+func (r *Report) add(scope, check string, status Status, message, hint string) {
+	r.Results = append(r.Results, Result{Scope: scope, Check: check, Status: status, Message: message, Hint: hint})
+}
+
+// Checker runs the checks
+type Checker struct {
+	// ResticVersion returns the path of restic and the output of `restic version`
+	ResticVersion func() (string, string, error)
+}
+
+// New returns a Checker that runs the restic on PATH
+func New() *Checker {
+	return &Checker{ResticVersion: resticVersion}
+}
+
+// resticVersion finds restic on PATH and asks it for its version
+func resticVersion() (string, string, error) {
+	path, err := exec.LookPath("restic")
+	if err != nil {
+		return "", "", err
+	}
+	out, err := exec.Command(path, "version").Output()
+	return path, string(out), err
+}
+
+// Run checks restic, the global config and the given repositories, or all
+// of them if none are given
+func (c *Checker) Run(repoNames ...string) (*Report, error) {
+	report := &Report{}
+
+	c.checkRestic(report)
+
+	paths, err := config.GetPaths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get paths: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		report.add(GlobalScope, "config", Fail, err.Error(), "fix config.toml or secret.toml")
+		return report, nil
+	}
+	report.add(GlobalScope, "config", Pass, "config.toml and secret.toml load", "")
+	checkTelegram(report, GlobalScope, cfg.Telegram)
+	checkExcludeFile(report, GlobalScope, filepath.Join(paths.ConfigDir, "core.exclude.txt"))
+
+	if len(repoNames) == 0 {
+		repoNames, err = config.ListRepos()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories: %w", err)
+		}
+		if len(repoNames) == 0 {
+			report.add(GlobalScope, "repos", Warn, "no repositories configured", "run 'restic-helpers init <repo-name>'")
+		}
+	}
+
+	for _, name := range repoNames {
+		checkRepo(report, name, cfg)
+	}
+
+	return report, nil
+}
+
+// checkRestic checks that restic is on PATH and recent enough
+func (c *Checker) checkRestic(report *Report) {
+	path, out, err := c.ResticVersion()
+	if errors.Is(err, exec.ErrNotFound) {
+		report.add(GlobalScope, "restic", Fail, "restic is not on PATH", "install restic: https://restic.net")
+		return
+	}
+	if err != nil {
+		report.add(GlobalScope, "restic", Fail, fmt.Sprintf("'restic version' failed: %v", err), "check that "+path+" runs")
+		return
+	}
+
+	m := resticVersionPattern.FindStringSubmatch(out)
+	if m == nil {
+		report.add(GlobalScope, "restic", Warn, fmt.Sprintf("could not read the version of %s", path), "")
+		return
+	}
+
+	var version [3]int
+	for i := range version {
+		version[i], _ = strconv.Atoi(m[i+1])
+	}
+	found := fmt.Sprintf("restic %d.%d.%d at %s", version[0], version[1], version[2], path)
+	for i := range version {
+		if version[i] != MinResticVersion[i] {
+			if version[i] < MinResticVersion[i] {
+				report.add(GlobalScope, "restic", Fail, found+" is too old",
+					fmt.Sprintf("upgrade to restic %d.%d.%d or newer (restic self-update)", MinResticVersion[0], MinResticVersion[1], MinResticVersion[2]))
+				return
+			}
+			break
+		}
+	}
+	report.add(GlobalScope, "restic", Pass, found, "")
+}
+
+// checkRepo checks one repository's configuration
+func checkRepo(report *Report, name string, global *config.Config) {
+	repo, err := config.LoadRepo(name)
+	if err != nil {
+		report.add(name, "config", Fail, err.Error(), "fix the files in repos/"+name+" or [repos."+name+"] in config.toml")
+		return
+	}
+
+	checkRepository(report, repo)
+	checkSecret(report, name, "password", repo.Password, true)
+	checkPaths(report, repo)
+
+	if repo.ExcludeFile != "" {
+		checkExcludeFile(report, name, repo.ExcludeFile)
+	}
+	if len(repo.Excludes) > 0 {
+		checkPatterns(report, name, "exclude", repo.Excludes)
+	}
+
+	checkHealthcheck(report, repo)
+	if repo.Telegram != nil {
+		checkTelegram(report, name, repo.TelegramSettings(global.Telegram))
+	}
+	for _, key := range slices.Sorted(maps.Keys(repo.Environment)) {
+		checkSecret(report, name, "env "+key, repo.Environment[key], false)
+	}
+	checkSchedules(report, repo)
+	checkReplicateTo(report, repo)
+}
+
+// checkRepository checks that the repository location is set
+func checkRepository(report *Report, repo *config.RepoConfig) {
+	if repo.Repository != "" {
+		report.add(repo.Name, "repository", Pass, repo.Repository, "")
+		return
+	}
+
+	data, err := os.ReadFile(repo.RepoFile)
+	if err != nil {
+		report.add(repo.Name, "repository", Fail, fmt.Sprintf("cannot read %s: %v", repo.RepoFile, err), "put the repository URL or path in "+repo.RepoFile)
+		return
+	}
+	location := strings.TrimSpace(string(data))
+	if location == "" || location == strings.TrimSpace(assets.RepoName) {
+		report.add(repo.Name, "repository", Fail, repo.RepoFile+" is empty or still the example", "put the repository URL or path in "+repo.RepoFile)
+		return
+	}
+	report.add(repo.Name, "repository", Pass, location, "")
+}
+
+// checkSecret checks that a secret can be read, without reading it from a
+// command. Secret files must not be readable by others.
+func checkSecret(report *Report, scope, check string, s config.Secret, required bool) {
+	switch {
+	case s.File != "":
+		info, err := os.Stat(s.File)
+		if err != nil {
+			report.add(scope, check, Fail, fmt.Sprintf("cannot read %s: %v", s.File, err), "create "+s.File)
+			return
+		}
+		if info.Size() == 0 {
+			report.add(scope, check, Fail, s.File+" is empty", "put the secret in "+s.File)
+			return
+		}
+		if secrets.IsEncrypted(s.File) {
+			checkIdentity(report, scope, check, s.File)
+			return
+		}
+		if data, err := os.ReadFile(s.File); err == nil && strings.TrimSpace(string(data)) == strings.TrimSpace(assets.RepoPassword) {
+			report.add(scope, check, Fail, s.File+" is still the example", "put the secret in "+s.File)
+			return
+		}
+		if mode := info.Mode().Perm(); mode&0o077 != 0 {
+			report.add(scope, check, Warn, fmt.Sprintf("%s has mode %04o", s.File, mode), "chmod 600 "+s.File)
+			return
+		}
+		report.add(scope, check, Pass, s.String(), "")
+	case s.Command != "":
+		fields := strings.Fields(s.Command)
+		if len(fields) == 0 {
+			report.add(scope, check, Fail, "password command is empty", "set a command or use a file")
+			return
+		}
+		program := fields[0]
+		if _, err := exec.LookPath(program); err != nil {
+			report.add(scope, check, Warn, fmt.Sprintf("%s is not on PATH", program), "install "+program+" or use its full path")
+			return
+		}
+		report.add(scope, check, Pass, s.String()+" (not run)", "")
+	case s.Env != "":
+		if os.Getenv(s.Env) == "" {
+			report.add(scope, check, Warn, fmt.Sprintf("$%s is not set in this shell", s.Env), "export "+s.Env+"; scheduled jobs need a file or command source")
+			return
+		}
+		report.add(scope, check, Pass, s.String(), "")
+	case s.Value != "":
+		report.add(scope, check, Pass, s.String(), "")
+	case required:
+		report.add(scope, check, Fail, "not set", "set password_file or password")
+	}
+}
+
+// checkIdentity checks that the age identity for an encrypted file exists
+func checkIdentity(report *Report, scope, check, path string) {
+	identity, err := config.IdentityPath()
+	if err != nil {
+		report.add(scope, check, Fail, err.Error(), "")
+		return
+	}
+	if _, err := os.Stat(identity); err != nil {
+		report.add(scope, check, Fail, fmt.Sprintf("%s needs the age identity %s: %v", path, identity, err), "restore the identity or set [age] identity in config.toml")
+		return
+	}
+	report.add(scope, check, Pass, fmt.Sprintf("file %s (age identity %s)", path, identity), "")
+}
+
+// checkPaths checks that there is something to back up and that it exists.
+// Lines of a paths file are glob patterns, like restic --files-from.
+func checkPaths(report *Report, repo *config.RepoConfig) {
+	patterns := repo.Paths
+	if repo.PathsFile != "" {
+		lines, err := readLines(repo.PathsFile)
+		if err != nil {
+			report.add(repo.Name, "paths", Fail, fmt.Sprintf("cannot read %s: %v", repo.PathsFile, err), "list the paths to back up in "+repo.PathsFile)
+			return
+		}
+		patterns = lines
+	}
+
+	if len(patterns) == 0 {
+		report.add(repo.Name, "paths", Fail, "no paths to back up", "list the paths to back up in paths.txt or paths")
+		return
+	}
+
+	var missing []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) > 0 {
+		report.add(repo.Name, "paths", Fail, "missing: "+strings.Join(missing, ", "), "create them or remove them from the path list")
+		return
+	}
+	report.add(repo.Name, "paths", Pass, fmt.Sprintf("%d paths exist", len(patterns)), "")
+}
+
+// checkExcludeFile checks the patterns of an exclude file, if it exists
+func checkExcludeFile(report *Report, scope, path string) {
+	lines, err := readLines(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		report.add(scope, "exclude", Fail, fmt.Sprintf("cannot read %s: %v", path, err), "")
+		return
+	}
+	checkPatterns(report, scope, "exclude "+filepath.Base(path), lines)
+}
+
+// checkPatterns checks that exclude patterns are valid globs
+func checkPatterns(report *Report, scope, check string, patterns []string) {
+	var bad []string
+	for _, pattern := range patterns {
+		// restic expands environment variables in patterns
+		if _, err := filepath.Match(os.ExpandEnv(pattern), ""); err != nil {
+			bad = append(bad, pattern)
+		}
+	}
+	if len(bad) > 0 {
+		report.add(scope, check, Fail, "invalid patterns: "+strings.Join(bad, ", "), "fix the brackets or escapes in these patterns")
+		return
+	}
+	report.add(scope, check, Pass, fmt.Sprintf("%d patterns", len(patterns)), "")
+}
+
+// checkHealthcheck checks that the healthcheck URL is well-formed
+func checkHealthcheck(report *Report, repo *config.RepoConfig) {
+	if repo.Healthcheck == "" {
+		return
+	}
+	if repo.Healthcheck == strings.TrimSpace(assets.RepoHealthcheck) {
+		report.add(repo.Name, "healthcheck", Fail, "still the example URL", "use the ping URL from healthchecks.io, or empty healthcheck.txt")
+		return
+	}
+	u, err := url.Parse(repo.Healthcheck)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		report.add(repo.Name, "healthcheck", Fail, fmt.Sprintf("%q is not an http(s) URL", repo.Healthcheck), "use the ping URL from healthchecks.io, e.g. https://hc-ping.com/<uuid>")
+		return
+	}
+	report.add(repo.Name, "healthcheck", Pass, repo.Healthcheck, "")
+}
+
+// checkTelegram checks that enabled Telegram notifications are complete
+func checkTelegram(report *Report, scope string, telegram config.TelegramConfig) {
+	if !telegram.Enabled {
+		report.add(scope, "telegram", Pass, "disabled", "")
+		return
+	}
+
+	var missing []string
+	if !telegram.BotToken.IsSet() {
+		missing = append(missing, "bot_token")
+	}
+	if telegram.ChatID == "" {
+		missing = append(missing, "chat_id")
+	}
+	if len(missing) > 0 {
+		report.add(scope, "telegram", Fail, "enabled but missing "+strings.Join(missing, " and "), "set them in secret.toml, or set enabled = false")
+		return
+	}
+	checkSecret(report, scope, "telegram bot_token", telegram.BotToken, true)
+}
+
+// checkSchedules checks that the daemon schedules parse
+func checkSchedules(report *Report, repo *config.RepoConfig) {
+	if repo.Schedule == nil {
+		return
+	}
+	exprs := []string{repo.Schedule.Backup, repo.Schedule.Check, repo.Schedule.Prune}
+	for i, task := range []string{"backup", "check", "prune"} {
+		expr := exprs[i]
+		if expr == "" {
+			continue
+		}
+		if _, err := cron.Parse(expr); err != nil {
+			report.add(repo.Name, "schedule "+task, Fail, err.Error(), "fix schedule.toml")
+			continue
+		}
+		report.add(repo.Name, "schedule "+task, Pass, expr, "")
+	}
+}
+
+// checkReplicateTo checks that every replicate_to target is a configured repository
+func checkReplicateTo(report *Report, repo *config.RepoConfig) {
+	for _, target := range repo.ReplicateTo {
+		if _, err := config.LoadRepo(target); err != nil {
+			report.add(repo.Name, "replicate_to "+target, Fail, err.Error(), "configure repos/"+target+" or [repos."+target+"] in config.toml")
+			continue
+		}
+		report.add(repo.Name, "replicate_to "+target, Pass, "configured", "")
+	}
+	if cycle := config.ReplicationCycle(repo); cycle != nil {
+		report.add(repo.Name, "replicate_to", Fail, "cycle "+strings.Join(cycle, " -> "), "remove one of the replicate_to entries")
+	}
+}
+
+// readLines returns the lines of a file that are neither blank nor comments
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
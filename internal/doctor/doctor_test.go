@@ -0,0 +1,174 @@
+package doctor
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+)
+
+// fakeRestic returns a ResticVersion that reports the given output
+func fakeRestic(out string, err error) func() (string, string, error) {
+	return func() (string, string, error) {
+		return "/usr/bin/restic", out, err
+	}
+}
+
+// find returns the result of a check
+func find(t *testing.T, report *Report, scope, check string) Result {
+	t.Helper()
+	for _, result := range report.Results {
+		if result.Scope == scope && result.Check == check {
+			return result
+		}
+	}
+	t.Fatalf("no %s result for %s in %+v", check, scope, report.Results)
+	return Result{}
+}
+
+// setupHome creates a config directory with the given files under a temp HOME
+func setupHome(t *testing.T, files map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// The caller's XDG directories would bypass HOME
+	for _, key := range config.DirEnvVars {
+		t.Setenv(key, "")
+	}
+	configDir := filepath.Join(home, ".config", "restic-helpers")
+	for name, content := range files {
+		path := filepath.Join(configDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return configDir
+}
+
+func TestCheckRestic(t *testing.T) {
+	tests := []struct {
+		out    string
+		err    error
+		status Status
+	}{
+		{"restic 0.17.3 compiled with go1.23.3 on linux/amd64\n", nil, Pass},
+		{"restic 0.13.0 compiled with go1.18 on darwin/arm64\n", nil, Pass},
+		{"restic 0.12.1 compiled with go1.16 on linux/amd64\n", nil, Fail},
+		{"restic development version\n", nil, Warn},
+		{"", exec.ErrNotFound, Fail},
+		{"", errors.New("exit status 1"), Fail},
+	}
+	for _, tt := range tests {
+		report := &Report{}
+		(&Checker{ResticVersion: fakeRestic(tt.out, tt.err)}).checkRestic(report)
+		if got := report.Results[0].Status; got != tt.status {
+			t.Errorf("checkRestic(%q, %v) = %s, want %s", tt.out, tt.err, got, tt.status)
+		}
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	tests := []struct {
+		secret config.Secret
+		status Status
+	}{
+		{config.Secret{Value: "hunter2"}, Pass},
+		{config.Secret{Command: "sh -c 'echo hunter2'"}, Pass},
+		{config.Secret{Command: "no-such-password-manager show"}, Warn},
+		{config.Secret{Command: " \t"}, Fail},
+		{config.Secret{}, Fail},
+	}
+	for _, tt := range tests {
+		report := &Report{}
+		checkSecret(report, "laptop", "password", tt.secret, true)
+		if got := report.Results[0].Status; got != tt.status {
+			t.Errorf("checkSecret(%+v) = %s, want %s", tt.secret, got, tt.status)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	configDir := setupHome(t, map[string]string{
+		"config.toml": "[telegram]\nenabled = true\nchat_id = \"1\"\n\n[repos.laptop]\nreplicate_to = [\"fresh\", \"offsite\"]\n\n[repos.fresh]\nreplicate_to = [\"laptop\"]\n",
+		// An example left from init, and a world-readable password
+		"repos/fresh/name.txt":         "sftp:user@endpoint:repo_location",
+		"repos/fresh/password.txt":     "your_password_here",
+		"repos/fresh/paths.txt":        "/path/you/want/to/backup\n",
+		"repos/fresh/healthcheck.txt":  "https://hc-ping.com/<some-uuid>",
+		"repos/laptop/name.txt":        "/srv/restic",
+		"repos/laptop/password.txt":    "hunter2\n",
+		"repos/laptop/exclude.txt":     "# comment\n*.tmp\n[unclosed\n",
+		"repos/laptop/healthcheck.txt": "hc-ping.com/abc",
+	})
+	laptopDir := filepath.Join(configDir, "repos", "laptop")
+	if err := os.WriteFile(filepath.Join(laptopDir, "paths.txt"), []byte(configDir+"\n/does/not/exist\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(laptopDir, "password.txt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := (&Checker{ResticVersion: fakeRestic("restic 0.17.3\n", nil)}).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	tests := []struct {
+		scope, check string
+		status       Status
+	}{
+		{GlobalScope, "restic", Pass},
+		{GlobalScope, "config", Pass},
+		{GlobalScope, "telegram", Fail},
+		{"fresh", "repository", Fail},
+		{"fresh", "password", Fail},
+		{"fresh", "paths", Fail},
+		{"fresh", "healthcheck", Fail},
+		{"laptop", "repository", Pass},
+		{"laptop", "password", Warn},
+		{"laptop", "paths", Fail},
+		{"laptop", "exclude exclude.txt", Fail},
+		{"laptop", "healthcheck", Fail},
+		{"laptop", "replicate_to fresh", Pass},
+		{"laptop", "replicate_to offsite", Fail},
+		{"laptop", "replicate_to", Fail}, // laptop -> fresh -> laptop
+		{"fresh", "replicate_to", Fail},
+	}
+	for _, tt := range tests {
+		if got := find(t, report, tt.scope, tt.check); got.Status != tt.status {
+			t.Errorf("%s %s = %s (%s), want %s", tt.scope, tt.check, got.Status, got.Message, tt.status)
+		}
+	}
+	if !report.Failed() {
+		t.Error("Failed() = false, want true")
+	}
+}
+
+func TestRunHealthy(t *testing.T) {
+	configDir := setupHome(t, map[string]string{
+		"config.toml":                  "[telegram]\nenabled = false\n",
+		"repos/laptop/name.txt":        "/srv/restic\n",
+		"repos/laptop/password.txt":    "hunter2\n",
+		"repos/laptop/healthcheck.txt": "https://hc-ping.com/abc",
+		"repos/laptop/schedule.toml":   "backup = \"0 2 * * *\"\n",
+	})
+	if err := os.WriteFile(filepath.Join(configDir, "repos", "laptop", "paths.txt"), []byte(configDir+"/repos/*\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := (&Checker{ResticVersion: fakeRestic("restic 0.17.3\n", nil)}).Run("laptop")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, result := range report.Results {
+		if result.Status != Pass {
+			t.Errorf("%s %s = %s: %s", result.Scope, result.Check, result.Status, result.Message)
+		}
+	}
+}
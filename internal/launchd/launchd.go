@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/catflyflyfly/restic-helpers/internal/config"
 	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
 	"howett.net/plist"
 )
 
@@ -16,118 +22,197 @@ const (
 	labelPrefix = "com.restic-helpers"
 )
 
+// lastExitStatusPattern matches the LastExitStatus line of `launchctl list <label>`
+var lastExitStatusPattern = regexp.MustCompile(`"LastExitStatus"\s*=\s*(-?\d+);`)
+
 // Job represents a launchd job configuration
 type Job struct {
 	Label                 string                  `plist:"Label"`
 	ProgramArguments      []string                `plist:"ProgramArguments"`
 	StartCalendarInterval []cron.CalendarInterval `plist:"StartCalendarInterval,omitempty"`
+	StartInterval         int                     `plist:"StartInterval,omitempty"`
 	StandardOutPath       string                  `plist:"StandardOutPath,omitempty"`
 	StandardErrorPath     string                  `plist:"StandardErrorPath,omitempty"`
 	EnvironmentVariables  map[string]string       `plist:"EnvironmentVariables,omitempty"`
 	RunAtLoad             bool                    `plist:"RunAtLoad"`
 }
 
-// GetLabel returns the launchd label for a repository
-func GetLabel(repoName string) string {
-	return fmt.Sprintf("%s.%s", labelPrefix, repoName)
+// GetLabel returns the launchd label for a job name (see scheduler.JobName)
+func GetLabel(name string) string {
+	return fmt.Sprintf("%s.%s", labelPrefix, name)
 }
 
-// GetPlistPath returns the path to the plist file for a repository
-func GetPlistPath(repoName string) (string, error) {
-	homeDir, err := os.UserHomeDir()
+// CreateJob creates a launchd job for scheduled backups
+func CreateJob(spec scheduler.Spec) (*Job, error) {
+	paths, err := config.GetPaths()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return filepath.Join(homeDir, "Library", "LaunchAgents", GetLabel(repoName)+".plist"), nil
-}
 
-// CreateJob creates a launchd job for scheduled backups
-func CreateJob(repoName string, cronExpr string, binaryPath string) (*Job, error) {
-	paths, err := config.GetPaths()
+	schedule, err := cron.Parse(spec.Schedule)
 	if err != nil {
 		return nil, err
 	}
 
-	intervals, err := cron.ParseCron(cronExpr)
+	trigger, err := schedule.LaunchdTrigger()
 	if err != nil {
 		return nil, err
 	}
+	// Only backup knows how to skip the extra runs of a gated trigger
+	if trigger.Gated && spec.TaskName() != scheduler.TaskBackup {
+		return nil, fmt.Errorf("schedule for %s needs more than %d calendar intervals", spec.TaskName(), cron.MaxScheduleEntries)
+	}
 
-	stdoutPath := filepath.Join(paths.StateDir, repoName+".out.log")
-	stderrPath := filepath.Join(paths.StateDir, repoName+".err.log")
+	stdoutPath := filepath.Join(paths.StateDir, spec.Name()+".out.log")
+	stderrPath := filepath.Join(paths.StateDir, spec.Name()+".err.log")
 
 	job := &Job{
-		Label: GetLabel(repoName),
-		ProgramArguments: []string{
-			binaryPath,
-			"backup",
-			repoName,
-		},
-		StartCalendarInterval: intervals,
+		Label: GetLabel(spec.Name()),
+		// A gated trigger fires more often than the schedule; backup skips the extra runs
+		ProgramArguments:      spec.Command(trigger.Gated),
+		StartCalendarInterval: trigger.Intervals,
 		StandardOutPath:       stdoutPath,
 		StandardErrorPath:     stderrPath,
-		RunAtLoad:             false, // backup only runs on schedule
+		// Without catch-up, backup only runs on schedule. With it, loading
+		// the job at login lets backup run a missed backup.
+		RunAtLoad: spec.CatchUp,
+	}
+	if len(spec.Env) > 0 {
+		job.EnvironmentVariables = spec.Env
+	}
+
+	if trigger.StartInterval > 0 {
+		if trigger.StartInterval < time.Second {
+			return nil, fmt.Errorf("interval %v is shorter than one second", trigger.StartInterval)
+		}
+		job.StartInterval = int(trigger.StartInterval / time.Second)
 	}
 
 	return job, nil
 }
 
-// Install installs a launchd job
-func Install(job *Job, repoName string) error {
-	plistPath, err := GetPlistPath(repoName)
+// EncodePlist encodes a job to plist XML string
+func EncodePlist(job *Job) (string, error) {
+	var buf bytes.Buffer
+	encoder := plist.NewEncoder(&buf)
+	encoder.Indent("\t")
+	if err := encoder.Encode(job); err != nil {
+		return "", fmt.Errorf("failed to encode plist: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// jobSummary describes the triggers of a job for verbose output
+func jobSummary(job *Job) string {
+	summary := fmt.Sprintf("Created %d calendar intervals", len(job.StartCalendarInterval))
+	if job.StartInterval > 0 {
+		summary = fmt.Sprintf("Created StartInterval of %d seconds", job.StartInterval)
+	}
+	if slices.Contains(job.ProgramArguments, "--when") {
+		summary += " (gated: backup skips runs the schedule does not match)"
+	}
+	return summary
+}
+
+// formatSchedule turns the triggers of a decoded job back into a readable schedule
+func formatSchedule(job *Job) string {
+	if i := slices.Index(job.ProgramArguments, "--when"); i >= 0 && i+1 < len(job.ProgramArguments) {
+		return job.ProgramArguments[i+1]
+	}
+	if job.StartInterval > 0 {
+		return "@every " + (time.Duration(job.StartInterval) * time.Second).String()
+	}
+	return cron.FormatIntervals(job.StartCalendarInterval)
+}
+
+// DecodePlist decodes plist XML back into a job
+func DecodePlist(data []byte) (*Job, error) {
+	var job Job
+	if _, err := plist.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode plist: %w", err)
+	}
+	return &job, nil
+}
+
+// Scheduler installs jobs as launchd agents
+type Scheduler struct {
+	Dir string
+	Run scheduler.Runner
+}
+
+// NewScheduler returns a Scheduler for the user's LaunchAgents directory
+func NewScheduler() (*Scheduler, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &Scheduler{
+		Dir: filepath.Join(homeDir, "Library", "LaunchAgents"),
+		Run: scheduler.ExecRunner,
+	}, nil
+}
 
-	// Ensure LaunchAgents directory exists
-	dir := filepath.Dir(plistPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create LaunchAgents directory: %w", err)
+// Name returns the backend name
+func (s *Scheduler) Name() string {
+	return "launchd"
+}
+
+// PlistPath returns the path to the plist file for a job name
+func (s *Scheduler) PlistPath(name string) string {
+	return filepath.Join(s.Dir, GetLabel(name)+".plist")
+}
+
+// Create builds the launchd job and its plist for a spec
+func (s *Scheduler) Create(spec scheduler.Spec) (*scheduler.Job, error) {
+	job, err := CreateJob(spec)
+	if err != nil {
+		return nil, err
 	}
 
-	// Encode plist
-	var buf bytes.Buffer
-	encoder := plist.NewEncoder(&buf)
-	encoder.Indent("\t")
-	if err := encoder.Encode(job); err != nil {
-		return fmt.Errorf("failed to encode plist: %w", err)
+	content, err := EncodePlist(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Job{
+		Spec: spec,
+		Files: []scheduler.File{
+			{Kind: "launchd job", Path: s.PlistPath(spec.Name()), Content: content},
+		},
+		Summary: jobSummary(job),
+	}, nil
+}
+
+// Install writes the plist and loads the job
+func (s *Scheduler) Install(job *scheduler.Job) error {
+	// Ensure LaunchAgents directory exists
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create LaunchAgents directory: %w", err)
 	}
 
 	// Write plist file
-	if err := os.WriteFile(plistPath, buf.Bytes(), 0644); err != nil {
+	plistPath := s.PlistPath(job.Spec.Name())
+	if err := os.WriteFile(plistPath, []byte(job.Files[0].Content), job.Spec.FileMode()); err != nil {
 		return fmt.Errorf("failed to write plist: %w", err)
 	}
 
 	// Load the job
-	cmd := exec.Command("launchctl", "load", plistPath)
-	if err := cmd.Run(); err != nil {
+	if _, err := s.Run(nil, "launchctl", "load", plistPath); err != nil {
 		return fmt.Errorf("failed to load launchd job: %w", err)
 	}
 
 	return nil
 }
 
-// EncodePlist encodes a job to plist XML string
-func EncodePlist(job *Job) (string, error) {
-	var buf bytes.Buffer
-	encoder := plist.NewEncoder(&buf)
-	encoder.Indent("\t")
-	if err := encoder.Encode(job); err != nil {
-		return "", fmt.Errorf("failed to encode plist: %w", err)
-	}
-	return buf.String(), nil
-}
-
-// Uninstall removes a launchd job
-func Uninstall(repoName string) error {
-	plistPath, err := GetPlistPath(repoName)
-	if err != nil {
-		return err
+// Uninstall unloads the job and removes its plist
+func (s *Scheduler) Uninstall(name string) error {
+	plistPath := s.PlistPath(name)
+	if _, err := os.Stat(plistPath); os.IsNotExist(err) {
+		return scheduler.ErrNotScheduled
 	}
 
 	// Unload the job (ignore errors if not loaded)
-	cmd := exec.Command("launchctl", "unload", plistPath)
-	_ = cmd.Run()
+	_, _ = s.Run(nil, "launchctl", "unload", plistPath)
 
 	// Remove the plist file
 	if err := os.Remove(plistPath); err != nil && !os.IsNotExist(err) {
@@ -136,3 +221,78 @@ func Uninstall(repoName string) error {
 
 	return nil
 }
+
+// List returns all restic-helpers jobs in the LaunchAgents directory
+func (s *Scheduler) List() ([]scheduler.Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, labelPrefix+".*.plist"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]scheduler.Entry, 0, len(matches))
+	for _, path := range matches {
+		label := strings.TrimSuffix(filepath.Base(path), ".plist")
+		entry, err := s.Status(strings.TrimPrefix(label, labelPrefix+"."))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// Status returns the installed job with the given name
+func (s *Scheduler) Status(name string) (*scheduler.Entry, error) {
+	plistPath := s.PlistPath(name)
+	content, err := os.ReadFile(plistPath)
+	if os.IsNotExist(err) {
+		return nil, scheduler.ErrNotScheduled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plist: %w", err)
+	}
+
+	job, err := DecodePlist(content)
+	if err != nil {
+		return nil, err
+	}
+
+	repoName, task := scheduler.ParseJobName(name)
+	entry := &scheduler.Entry{
+		Repo:       repoName,
+		Task:       task,
+		Backend:    s.Name(),
+		Schedule:   formatSchedule(job),
+		StdoutPath: job.StandardOutPath,
+		StderrPath: job.StandardErrorPath,
+		Files: []scheduler.File{
+			{Kind: "launchd job", Path: plistPath, Content: string(content)},
+		},
+	}
+
+	// launchctl list fails if the job is not loaded
+	if out, err := s.Run(nil, "launchctl", "list", job.Label); err == nil {
+		entry.Loaded = true
+		if m := lastExitStatusPattern.FindSubmatch(out); m != nil {
+			status, _ := strconv.Atoi(string(m[1]))
+			code := exitCode(status)
+			entry.LastExitStatus = &code
+		}
+	}
+
+	return entry, nil
+}
+
+// exitCode decodes the wait status launchctl reports as LastExitStatus, e.g.
+// 256 for exit code 1. A job killed by a signal gets 128 plus its number, as
+// in the shell; launchctl reports some of those as the negated signal.
+func exitCode(status int) int {
+	if status < 0 {
+		return 128 - status
+	}
+	ws := syscall.WaitStatus(status)
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
@@ -0,0 +1,209 @@
+package launchd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+)
+
+// recorder is a stub scheduler.Runner that records the commands it receives.
+type recorder struct {
+	commands []string
+	outputs  map[string]string
+}
+
+func (r *recorder) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, command)
+	if out, ok := r.outputs[command]; ok {
+		return []byte(out), nil
+	}
+	if args[0] == "list" {
+		return nil, errors.New("could not find service")
+	}
+	return nil, nil
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *recorder) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	rec := &recorder{}
+	return &Scheduler{Dir: filepath.Join(t.TempDir(), "LaunchAgents"), Run: rec.run}, rec
+}
+
+func TestSchedulerInstallUninstall(t *testing.T) {
+	s, rec := newTestScheduler(t)
+
+	job, err := s.Create(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/usr/local/bin/restic-helpers"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(job.Files) != 1 || job.Files[0].Path != s.PlistPath("laptop") {
+		t.Fatalf("Create() files = %+v", job.Files)
+	}
+
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	content, err := os.ReadFile(s.PlistPath("laptop"))
+	if err != nil {
+		t.Fatalf("plist not written: %v", err)
+	}
+	if !strings.Contains(string(content), "<string>com.restic-helpers.laptop</string>") {
+		t.Errorf("plist missing label:\n%s", content)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Repo != "laptop" {
+		t.Errorf("List() = %+v, want one entry for laptop", entries)
+	}
+
+	if err := s.Uninstall("laptop"); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if _, err := os.Stat(s.PlistPath("laptop")); !os.IsNotExist(err) {
+		t.Error("plist still exists after Uninstall()")
+	}
+
+	want := []string{
+		"launchctl load " + s.PlistPath("laptop"),
+		"launchctl list com.restic-helpers.laptop",
+		"launchctl unload " + s.PlistPath("laptop"),
+	}
+	if strings.Join(rec.commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", rec.commands, want)
+	}
+}
+
+func TestSchedulerStatus(t *testing.T) {
+	s, rec := newTestScheduler(t)
+	rec.outputs = map[string]string{
+		"launchctl list com.restic-helpers.laptop": "{\n\t\"Label\" = \"com.restic-helpers.laptop\";\n\t\"LastExitStatus\" = 256;\n};\n",
+	}
+
+	job, err := s.Create(scheduler.Spec{Repo: "laptop", Schedule: "0 9 * * 1-5", Binary: "/usr/local/bin/restic-helpers"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	entry, err := s.Status("laptop")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if entry.Schedule != "0 9 * * 1-5" {
+		t.Errorf("Schedule = %q, want %q", entry.Schedule, "0 9 * * 1-5")
+	}
+	if !strings.HasSuffix(entry.StdoutPath, "laptop.out.log") || !strings.HasSuffix(entry.StderrPath, "laptop.err.log") {
+		t.Errorf("log paths = %q, %q", entry.StdoutPath, entry.StderrPath)
+	}
+	if !entry.Loaded || entry.LastExitStatus == nil || *entry.LastExitStatus != 1 {
+		t.Errorf("Loaded = %v, LastExitStatus = %v, want loaded with status 1", entry.Loaded, entry.LastExitStatus)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct{ status, want int }{
+		{0, 0},
+		{256, 1},
+		{3 << 8, 3},
+		{15, 143}, // killed by SIGTERM
+		{-9, 137},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.status); got != tt.want {
+			t.Errorf("exitCode(%d) = %d, want %d", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerNotScheduled(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	if _, err := s.Status("missing"); !errors.Is(err, scheduler.ErrNotScheduled) {
+		t.Errorf("Status() error = %v, want ErrNotScheduled", err)
+	}
+	if err := s.Uninstall("missing"); !errors.Is(err, scheduler.ErrNotScheduled) {
+		t.Errorf("Uninstall() error = %v, want ErrNotScheduled", err)
+	}
+}
+
+func TestCreateJobEvery(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	job, err := CreateJob(scheduler.Spec{Repo: "laptop", Schedule: "@every 6h", Binary: "/usr/local/bin/restic-helpers"})
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	if job.StartInterval != 6*60*60 || len(job.StartCalendarInterval) != 0 {
+		t.Errorf("StartInterval = %d, StartCalendarInterval = %v, want 21600 and none", job.StartInterval, job.StartCalendarInterval)
+	}
+	if got := formatSchedule(job); got != "@every 6h0m0s" {
+		t.Errorf("formatSchedule() = %q, want %q", got, "@every 6h0m0s")
+	}
+}
+
+func TestCreateJobGated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	job, err := CreateJob(scheduler.Spec{Repo: "laptop", Schedule: "*/5 9-17 * * 1-5", Binary: "/usr/local/bin/restic-helpers"})
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	if len(job.StartCalendarInterval) != 12 {
+		t.Errorf("StartCalendarInterval has %d entries, want 12", len(job.StartCalendarInterval))
+	}
+	want := "/usr/local/bin/restic-helpers backup laptop --scheduled --when */5 9-17 * * 1-5"
+	if got := strings.Join(job.ProgramArguments, " "); got != want {
+		t.Errorf("ProgramArguments = %q, want %q", got, want)
+	}
+	if got := formatSchedule(job); got != "*/5 9-17 * * 1-5" {
+		t.Errorf("formatSchedule() = %q, want the original expression", got)
+	}
+}
+
+func TestCreateJobCatchUp(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	job, err := CreateJob(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/usr/local/bin/restic-helpers", CatchUp: true})
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	if !job.RunAtLoad {
+		t.Error("RunAtLoad = false, want true")
+	}
+	want := "/usr/local/bin/restic-helpers backup laptop --scheduled --when 0 2 * * * --catch-up"
+	if got := strings.Join(job.ProgramArguments, " "); got != want {
+		t.Errorf("ProgramArguments = %q, want %q", got, want)
+	}
+}
+
+func TestCreateJobEnvironment(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	job, err := CreateJob(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/usr/local/bin/restic-helpers", Env: map[string]string{"XDG_STATE_HOME": "/srv/state"}})
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	if job.EnvironmentVariables["XDG_STATE_HOME"] != "/srv/state" {
+		t.Errorf("EnvironmentVariables = %v", job.EnvironmentVariables)
+	}
+
+	plist, err := EncodePlist(job)
+	if err != nil {
+		t.Fatalf("EncodePlist() error = %v", err)
+	}
+	if !strings.Contains(plist, "<key>XDG_STATE_HOME</key>") {
+		t.Errorf("plist has no environment:\n%s", plist)
+	}
+}
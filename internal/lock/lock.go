@@ -0,0 +1,118 @@
+// Package lock keeps runs on the same repository from overlapping, with a
+// flock on a file in the state directory.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pollInterval is how often Acquire retries a held lock
+var pollInterval = time.Second
+
+// Lock is a held run lock. The kernel releases it when the process exits,
+// however it exits.
+type Lock struct {
+	file *os.File
+	// StalePID is the process that held the lock before and exited without
+	// releasing it, e.g. because it was killed; 0 if there was none
+	StalePID int
+}
+
+// HeldError is returned while another process holds the lock
+type HeldError struct {
+	// PID is the process holding the lock, 0 if it has not written it yet
+	PID int
+}
+
+func (e *HeldError) Error() string {
+	if e.PID == 0 {
+		return "locked by another process"
+	}
+	return fmt.Sprintf("locked by PID %d", e.PID)
+}
+
+// Path returns the lock file path for a repository
+func Path(stateDir, repoName string) string {
+	return filepath.Join(stateDir, repoName+".lock")
+}
+
+// TryAcquire takes the lock at path, or returns a *HeldError if another run
+// holds it
+func TryAcquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		pid := readPID(file)
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, &HeldError{PID: pid}
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// Release clears the PID, so one left behind belongs to a dead run
+	l := &Lock{file: file, StalePID: readPID(file)}
+	if err := writePID(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return l, nil
+}
+
+// Acquire waits until the lock at path is free and takes it, or returns the
+// context's error once ctx is done
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	for {
+		l, err := TryAcquire(path)
+		var held *HeldError
+		if !errors.As(err, &held) {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Release clears the recorded PID and unlocks
+func (l *Lock) Release() error {
+	err := l.file.Truncate(0)
+	return errors.Join(err, l.file.Close())
+}
+
+// readPID returns the PID recorded in a lock file, 0 if there is none
+func readPID(file *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := file.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// writePID records the current process in a held lock file
+func writePID(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
@@ -0,0 +1,87 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTryAcquire(t *testing.T) {
+	path := Path(filepath.Join(t.TempDir(), "state"), "laptop")
+
+	l, err := TryAcquire(path)
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+	if l.StalePID != 0 {
+		t.Errorf("StalePID = %d, want 0", l.StalePID)
+	}
+
+	// A second open file holds its own lock, even in the same process
+	_, err = TryAcquire(path)
+	var held *HeldError
+	if !errors.As(err, &held) || held.PID != os.Getpid() {
+		t.Fatalf("second TryAcquire error = %v, want held by PID %d", err, os.Getpid())
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	l, err = TryAcquire(path)
+	if err != nil {
+		t.Fatalf("TryAcquire after Release failed: %v", err)
+	}
+	if l.StalePID != 0 {
+		t.Errorf("StalePID after Release = %d, want 0", l.StalePID)
+	}
+	l.Release()
+}
+
+func TestTryAcquireStale(t *testing.T) {
+	path := Path(t.TempDir(), "laptop")
+	// Left by a run that was killed while holding the lock
+	if err := os.WriteFile(path, []byte("4242\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := TryAcquire(path)
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+	defer l.Release()
+	if l.StalePID != 4242 {
+		t.Errorf("StalePID = %d, want 4242", l.StalePID)
+	}
+	if pid := readPID(l.file); pid != os.Getpid() {
+		t.Errorf("recorded PID = %d, want %d", pid, os.Getpid())
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	path := Path(t.TempDir(), "laptop")
+
+	held, err := TryAcquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire error = %v, want deadline exceeded", err)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		held.Release()
+	}()
+	l, err := Acquire(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	l.Release()
+}
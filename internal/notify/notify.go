@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/catflyflyfly/restic-helpers/internal/config"
@@ -52,7 +53,7 @@ func (n *Notifier) validateTelegram() error {
 	if n.telegram == nil || !n.telegram.Enabled {
 		return ErrTelegramDisabled
 	}
-	if n.telegram.BotToken == "" {
+	if !n.telegram.BotToken.IsSet() {
 		return ErrTelegramNoToken
 	}
 	if n.telegram.ChatID == "" {
@@ -76,18 +77,27 @@ func (n *Notifier) SendTelegram(message string) error {
 		return nil
 	}
 
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.telegram.BotToken)
-
 	if n.dryRun {
-		fmt.Printf("curl -fsS -X POST %s -d chat_id=%s -d text='%s'\n", apiURL, n.telegram.ChatID, message)
+		// The token is neither resolved nor printed in dry-run mode
+		fmt.Printf("curl -fsS -X POST %s -d chat_id=%s -d text='%s'\n", telegramURL("<bot_token>"), n.telegram.ChatID, message)
 		return nil
 	}
 
-	resp, err := n.client.PostForm(apiURL, url.Values{
+	token, err := n.telegram.BotToken.Resolve()
+	if err != nil {
+		return fmt.Errorf("failed to read telegram bot_token: %w", err)
+	}
+
+	resp, err := n.client.PostForm(telegramURL(token), url.Values{
 		"chat_id": {n.telegram.ChatID},
 		"text":    {message},
 	})
 	if err != nil {
+		// The URL holds the token, so keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = telegramURL("<bot_token>")
+		}
 		return fmt.Errorf("failed to send telegram message: %w", err)
 	}
 	defer resp.Body.Close()
@@ -99,8 +109,19 @@ func (n *Notifier) SendTelegram(message string) error {
 	return nil
 }
 
+// telegramURL returns the sendMessage endpoint for a bot token
+func telegramURL(token string) string {
+	return fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token)
+}
+
 // PingHealthcheck pings a healthchecks.io URL with the given status
 func (n *Notifier) PingHealthcheck(status string) error {
+	return n.PingHealthcheckWithBody(status, "")
+}
+
+// PingHealthcheckWithBody pings a healthchecks.io URL with the given status
+// and a body, such as a backup summary, which healthchecks.io keeps with the ping
+func (n *Notifier) PingHealthcheckWithBody(status, body string) error {
 	if err := n.validateHealthcheck(); err != nil {
 		n.logVerbose("Skipping healthcheck: %v", err)
 		return nil
@@ -112,16 +133,29 @@ func (n *Notifier) PingHealthcheck(status string) error {
 		pingURL = n.healthcheckURL + "/start"
 	case "fail":
 		pingURL = n.healthcheckURL + "/fail"
+	case "log":
+		// Logged as an event without changing the check's state
+		pingURL = n.healthcheckURL + "/log"
 	default:
 		pingURL = n.healthcheckURL
 	}
 
 	if n.dryRun {
-		fmt.Printf("curl -fsS -m 10 --retry 5 -o /dev/null %s\n", pingURL)
+		if body != "" {
+			fmt.Printf("curl -fsS -m 10 --retry 5 -o /dev/null --data-raw %q %s\n", body, pingURL)
+		} else {
+			fmt.Printf("curl -fsS -m 10 --retry 5 -o /dev/null %s\n", pingURL)
+		}
 		return nil
 	}
 
-	resp, err := n.client.Get(pingURL)
+	var resp *http.Response
+	var err error
+	if body != "" {
+		resp, err = n.client.Post(pingURL, "text/plain; charset=utf-8", strings.NewReader(body))
+	} else {
+		resp, err = n.client.Get(pingURL)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to ping healthcheck: %w", err)
 	}
@@ -155,7 +189,7 @@ func (n *Notifier) PrintDryRunSummary() {
 	if err := n.validateTelegram(); err != nil {
 		fmt.Printf("[dry-run]   Telegram: %v\n", err)
 	} else {
-		fmt.Printf("[dry-run]   Telegram: enabled (chat_id: %s)\n", n.telegram.ChatID)
+		fmt.Printf("[dry-run]   Telegram: enabled (chat_id: %s, bot_token: %s)\n", n.telegram.ChatID, n.telegram.BotToken)
 		fmt.Println("[dry-run]     On failure:")
 		n.SendTelegram("<error message>")
 	}
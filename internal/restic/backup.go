@@ -0,0 +1,209 @@
+// Package restic decodes the JSON output of restic commands.
+package restic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// BackupStatus is a progress message of restic backup --json
+type BackupStatus struct {
+	PercentDone      float64  `json:"percent_done"`
+	TotalFiles       int      `json:"total_files"`
+	FilesDone        int      `json:"files_done"`
+	TotalBytes       int64    `json:"total_bytes"`
+	BytesDone        int64    `json:"bytes_done"`
+	ErrorCount       int      `json:"error_count"`
+	SecondsElapsed   int      `json:"seconds_elapsed"`
+	SecondsRemaining int      `json:"seconds_remaining"`
+	CurrentFiles     []string `json:"current_files"`
+}
+
+// BackupSummary is the message restic backup --json ends with
+type BackupSummary struct {
+	FilesNew            int     `json:"files_new"`
+	FilesChanged        int     `json:"files_changed"`
+	FilesUnmodified     int     `json:"files_unmodified"`
+	DirsNew             int     `json:"dirs_new"`
+	DirsChanged         int     `json:"dirs_changed"`
+	DirsUnmodified      int     `json:"dirs_unmodified"`
+	DataAdded           int64   `json:"data_added"`
+	TotalFilesProcessed int     `json:"total_files_processed"`
+	TotalBytesProcessed int64   `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+	SnapshotID          string  `json:"snapshot_id"`
+}
+
+// Duration returns how long the backup took
+func (s *BackupSummary) Duration() time.Duration {
+	return time.Duration(s.TotalDuration * float64(time.Second)).Round(time.Second)
+}
+
+// String formats the summary like restic's own output
+func (s *BackupSummary) String() string {
+	lines := []string{
+		fmt.Sprintf("Files:       %5d new, %5d changed, %5d unmodified", s.FilesNew, s.FilesChanged, s.FilesUnmodified),
+		fmt.Sprintf("Dirs:        %5d new, %5d changed, %5d unmodified", s.DirsNew, s.DirsChanged, s.DirsUnmodified),
+		fmt.Sprintf("Added to the repository: %s", FormatBytes(s.DataAdded)),
+		fmt.Sprintf("Processed %d files, %s in %s", s.TotalFilesProcessed, FormatBytes(s.TotalBytesProcessed), s.Duration()),
+	}
+	if s.SnapshotID != "" {
+		lines = append(lines, fmt.Sprintf("Snapshot %s saved", ShortID(s.SnapshotID)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ShortID returns the 8 character form of a snapshot ID restic prints
+func ShortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// FormatBytes formats a size with binary units, like restic
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n), 0
+	for value >= unit && exp < 5 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.3f %ciB", value, "KMGTP"[exp-1])
+}
+
+// BackupError is a file or directory restic backup could not read
+type BackupError struct {
+	Item    string `json:"item,omitempty"`
+	During  string `json:"during,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e BackupError) String() string {
+	if e.Item == "" {
+		return e.Message
+	}
+	return e.Item + ": " + e.Message
+}
+
+// BackupOutput decodes the JSON lines of restic backup --json as they are written
+type BackupOutput struct {
+	// OnStatus is called for every progress message
+	OnStatus func(BackupStatus)
+	// OnVerbose is called for every file and directory with --verbose
+	OnVerbose func(action, item string)
+	// Text receives lines that are not JSON messages
+	Text io.Writer
+	// ErrorText receives restic's error output, with JSON errors as text
+	ErrorText io.Writer
+
+	// Summary is set once restic has saved the snapshot
+	Summary *BackupSummary
+	// Errors are the files and directories restic could not read
+	Errors []BackupError
+
+	stdout, stderr lineWriter
+}
+
+// lineWriter calls handle for every complete line written to it
+type lineWriter struct {
+	line   []byte
+	handle func(line []byte)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		w.handle(w.line[:i])
+		w.line = w.line[i+1:]
+	}
+	return len(p), nil
+}
+
+// message holds the fields of every message type restic backup --json writes
+type message struct {
+	MessageType string `json:"message_type"`
+	BackupStatus
+	BackupSummary
+	Action string `json:"action"`
+	Item   string `json:"item"`
+	During string `json:"during"`
+	Error  struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Reset forgets the summary and errors of a previous attempt
+func (o *BackupOutput) Reset() {
+	o.Summary = nil
+	o.Errors = nil
+}
+
+// Write decodes restic's standard output
+func (o *BackupOutput) Write(p []byte) (int, error) {
+	o.stdout.handle = o.handle
+	return o.stdout.Write(p)
+}
+
+// Stderr returns a writer that collects the errors in restic's error output
+func (o *BackupOutput) Stderr() io.Writer {
+	o.stderr.handle = o.handleError
+	return &o.stderr
+}
+
+// handle decodes one line of output
+func (o *BackupOutput) handle(line []byte) {
+	var msg message
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	if err := json.Unmarshal(line, &msg); err != nil || msg.MessageType == "" {
+		if o.Text != nil {
+			_, _ = o.Text.Write(append(line, '\n'))
+		}
+		return
+	}
+
+	switch msg.MessageType {
+	case "status":
+		if o.OnStatus != nil {
+			o.OnStatus(msg.BackupStatus)
+		}
+	case "verbose_status":
+		if o.OnVerbose != nil {
+			o.OnVerbose(msg.Action, msg.Item)
+		}
+	case "summary":
+		summary := msg.BackupSummary
+		o.Summary = &summary
+	}
+}
+
+// handleError decodes one line of error output. Older restic versions print
+// errors as "error: ..." text even with --json.
+func (o *BackupOutput) handleError(line []byte) {
+	var msg message
+	text := string(line) + "\n"
+	if err := json.Unmarshal(line, &msg); err == nil && msg.MessageType == "error" {
+		backupErr := BackupError{Item: msg.Item, During: msg.During, Message: msg.Error.Message}
+		o.Errors = append(o.Errors, backupErr)
+		text = "error: " + backupErr.String() + "\n"
+	} else if message, ok := strings.CutPrefix(string(line), "error: "); ok {
+		o.Errors = append(o.Errors, BackupError{Message: message})
+	}
+
+	if o.ErrorText != nil {
+		_, _ = io.WriteString(o.ErrorText, text)
+	}
+}
@@ -0,0 +1,104 @@
+package restic
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const backupOutput = `{"message_type":"status","percent_done":0,"total_files":1,"total_bytes":12}
+{"message_type":"verbose_status","action":"new","item":"/srv/notes.txt","duration":0.01,"data_size":12}
+{"message_type":"status","seconds_elapsed":1,"percent_done":0.5,"total_files":2,"files_done":1,"total_bytes":24,"bytes_done":12,"current_files":["/srv/a"]}
+not json
+{"message_type":"summary","files_new":2,"files_changed":1,"files_unmodified":40,"dirs_new":1,"dirs_changed":0,"dirs_unmodified":3,"data_blobs":2,"tree_blobs":2,"data_added":1536,"total_files_processed":43,"total_bytes_processed":3221225472,"total_duration":83.6,"snapshot_id":"4f2a1b3c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a"}
+`
+
+func TestBackupOutput(t *testing.T) {
+	var statuses []BackupStatus
+	var verbose []string
+	var text bytes.Buffer
+	out := &BackupOutput{
+		OnStatus:  func(s BackupStatus) { statuses = append(statuses, s) },
+		OnVerbose: func(action, item string) { verbose = append(verbose, action+" "+item) },
+		Text:      &text,
+	}
+
+	// Lines arrive split across writes
+	for _, chunk := range strings.SplitAfter(backupOutput, "e") {
+		if _, err := out.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(statuses) != 2 || statuses[1].FilesDone != 1 || statuses[1].PercentDone != 0.5 {
+		t.Errorf("statuses = %+v", statuses)
+	}
+	if len(verbose) != 1 || verbose[0] != "new /srv/notes.txt" {
+		t.Errorf("verbose = %q", verbose)
+	}
+	if text.String() != "not json\n" {
+		t.Errorf("text = %q", text.String())
+	}
+
+	s := out.Summary
+	if s == nil {
+		t.Fatal("expected a summary")
+	}
+	if s.FilesNew != 2 || s.FilesChanged != 1 || s.FilesUnmodified != 40 || s.DataAdded != 1536 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.Duration().String() != "1m24s" {
+		t.Errorf("Duration() = %s", s.Duration())
+	}
+	for _, want := range []string{"Added to the repository: 1.500 KiB", "43 files, 3.000 GiB in 1m24s", "Snapshot 4f2a1b3c saved"} {
+		if !strings.Contains(s.String(), want) {
+			t.Errorf("String() has no %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestBackupOutputErrors(t *testing.T) {
+	var text bytes.Buffer
+	out := &BackupOutput{ErrorText: &text}
+	stderr := out.Stderr()
+	lines := `{"message_type":"error","error":{"message":"open /srv/db: permission denied"},"during":"archival","item":"/srv/db"}
+error: lstat /srv/gone: no such file or directory
+Warning: at least one source file could not be read
+`
+	if _, err := io.WriteString(stderr, lines); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []BackupError{
+		{Item: "/srv/db", During: "archival", Message: "open /srv/db: permission denied"},
+		{Message: "lstat /srv/gone: no such file or directory"},
+	}
+	if !slices.Equal(out.Errors, want) {
+		t.Errorf("Errors = %+v, want %+v", out.Errors, want)
+	}
+	wantText := "error: /srv/db: open /srv/db: permission denied\n" + lines[strings.Index(lines, "\n")+1:]
+	if text.String() != wantText {
+		t.Errorf("text = %q, want %q", text.String(), wantText)
+	}
+
+	out.Reset()
+	if out.Errors != nil {
+		t.Error("Reset should forget the errors")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:       "0 B",
+		1023:    "1023 B",
+		1024:    "1.000 KiB",
+		5 << 20: "5.000 MiB",
+	}
+	for n, want := range tests {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
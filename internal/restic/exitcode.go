@@ -0,0 +1,68 @@
+package restic
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Errors for restic's exit codes, see "Exit codes" in the restic manual
+var (
+	ErrFatal         = errors.New("restic failed")
+	ErrIncomplete    = errors.New("snapshot is incomplete, some source files could not be read")
+	ErrRepoMissing   = errors.New("repository does not exist")
+	ErrLocked        = errors.New("repository is locked")
+	ErrWrongPassword = errors.New("wrong password")
+)
+
+// exitCodes maps restic's exit codes to their errors
+var exitCodes = map[int]error{
+	1:  ErrFatal,
+	3:  ErrIncomplete,
+	10: ErrRepoMissing,
+	11: ErrLocked,
+	12: ErrWrongPassword,
+}
+
+// ExitError is a restic exit code with a known meaning
+type ExitError struct {
+	// Kind is one of the Err* errors
+	Kind error
+	exit *exec.ExitError
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%v (exit code %d)", e.Kind, e.exit.ExitCode())
+}
+
+// Unwrap returns the kind and the exec error, so both errors.Is(err, ErrLocked)
+// and errors.As(err, &exitErr) work
+func (e *ExitError) Unwrap() []error {
+	return []error{e.Kind, e.exit}
+}
+
+// Classify turns the error of a restic command with a known exit code into an
+// *ExitError, and returns other errors unchanged
+func Classify(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if kind, ok := exitCodes[exitErr.ExitCode()]; ok {
+		return &ExitError{Kind: kind, exit: exitErr}
+	}
+	return err
+}
+
+// Transient reports whether retrying could fix a failed restic command: a
+// fatal error (exit 1, which includes network and backend errors), a locked
+// repository, or an exit code restic does not document, such as being killed
+// by a signal. An incomplete snapshot, a missing repository, a wrong password
+// and a restic that could not be started are permanent.
+func Transient(err error) bool {
+	if errors.Is(err, ErrFatal) || errors.Is(err, ErrLocked) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitCodes[exitErr.ExitCode()] == nil
+}
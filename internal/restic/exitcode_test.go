@@ -0,0 +1,52 @@
+package restic
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		code      string
+		kind      error
+		transient bool
+	}{
+		{"1", ErrFatal, true},
+		{"3", ErrIncomplete, false},
+		{"10", ErrRepoMissing, false},
+		{"11", ErrLocked, true},
+		{"12", ErrWrongPassword, false},
+		{"130", nil, true},
+	}
+	for _, tt := range tests {
+		err := Classify(exec.Command("/bin/sh", "-c", "exit "+tt.code).Run())
+		if err == nil {
+			t.Fatalf("exit %s: expected an error", tt.code)
+		}
+
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() == 0 {
+			t.Errorf("exit %s: expected the *exec.ExitError to unwrap, got %v", tt.code, err)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("exit %s: error = %v, want %v", tt.code, err, tt.kind)
+		}
+		if tt.kind != nil && !strings.Contains(err.Error(), "exit code "+tt.code) {
+			t.Errorf("exit %s: error %q has no exit code", tt.code, err)
+		}
+		if Transient(err) != tt.transient {
+			t.Errorf("exit %s: Transient = %v, want %v", tt.code, !tt.transient, tt.transient)
+		}
+	}
+
+	// A restic that cannot be started stays that way
+	if err := Classify(exec.Command("/nonexistent/restic").Run()); Transient(err) {
+		t.Errorf("Transient(%v) = true, want false", err)
+	}
+
+	if Classify(nil) != nil {
+		t.Error("Classify(nil) should be nil")
+	}
+}
@@ -39,10 +39,21 @@ func (r Config) Backoff() *backoff.ExponentialBackOff {
 // LogFunc is a function type for logging retry attempts
 type LogFunc func(format string, args ...any)
 
+// Permanent marks an error that retrying cannot fix, which stops
+// RunWithRetry at once and returns err
+func Permanent(err error) error {
+	return backoff.Permanent(err)
+}
+
 // RunWithRetry executes an operation with retry logic using exponential backoff.
 // The operation function is called on each attempt.
 // The logFn is called to log verbose messages about retry attempts.
 func RunWithRetry(name string, operation func() error, cfg Config, logFn LogFunc) error {
+	return RunWithRetryContext(context.Background(), name, operation, cfg, logFn)
+}
+
+// RunWithRetryContext is RunWithRetry, but stops retrying once ctx is cancelled.
+func RunWithRetryContext(ctx context.Context, name string, operation func() error, cfg Config, logFn LogFunc) error {
 	attempt := 0
 	op := func() (struct{}, error) {
 		attempt++
@@ -55,7 +66,7 @@ func RunWithRetry(name string, operation func() error, cfg Config, logFn LogFunc
 	}
 
 	_, err := backoff.Retry(
-		context.Background(),
+		ctx,
 		op,
 		backoff.WithBackOff(cfg.Backoff()),
 		backoff.WithMaxTries(uint(cfg.MaxAttempts)),
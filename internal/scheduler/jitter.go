@@ -0,0 +1,23 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// Jitter returns a delay in [0, max) derived from seed. The same seed always
+// yields the same delay, so a host starts at a consistent time each run while
+// hosts sharing a schedule spread out.
+func Jitter(seed string, max time.Duration) time.Duration {
+	if max < time.Second {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return time.Duration(h.Sum64()%uint64(max/time.Second)) * time.Second
+}
+
+// JitterSeed returns the seed for a task of a repository on a host
+func JitterSeed(hostname, repoName, task string) string {
+	return hostname + "/" + repoName + "/" + task
+}
@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	max := 10 * time.Minute
+
+	if got := Jitter("host-a/laptop/backup", 0); got != 0 {
+		t.Errorf("Jitter() with no max = %v, want 0", got)
+	}
+
+	first := Jitter("host-a/laptop/backup", max)
+	if first != Jitter("host-a/laptop/backup", max) {
+		t.Error("Jitter() is not stable for the same seed")
+	}
+
+	seen := make(map[time.Duration]bool)
+	for _, host := range []string{"host-a", "host-b", "host-c", "host-d", "host-e"} {
+		d := Jitter(JitterSeed(host, "laptop", "backup"), max)
+		if d < 0 || d >= max {
+			t.Errorf("Jitter(%s) = %v, want within [0, %v)", host, d, max)
+		}
+		if d%time.Second != 0 {
+			t.Errorf("Jitter(%s) = %v, want whole seconds", host, d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Jitter() gives every host the same delay")
+	}
+}
@@ -0,0 +1,178 @@
+// Package scheduler defines the interface implemented by the backends that
+// install scheduled backup jobs (launchd, systemd, ...).
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var ErrNotScheduled = errors.New("no scheduled job found")
+
+// Tasks that can be scheduled
+const (
+	TaskBackup = "backup"
+	TaskCheck  = "check"
+	TaskPrune  = "prune"
+)
+
+// Tasks lists the tasks that can be scheduled
+var Tasks = []string{TaskBackup, TaskCheck, TaskPrune}
+
+// Spec describes a scheduled job to create
+type Spec struct {
+	Repo     string
+	Schedule string
+	Binary   string
+	// Task is the command the job runs; empty means backup
+	Task string
+	// CatchUp runs a missed backup on startup or wake (see backup --catch-up)
+	CatchUp bool
+	// Env holds environment variables to set in the job
+	Env map[string]string
+}
+
+// TaskName returns the task the job runs
+func (s Spec) TaskName() string {
+	if s.Task == "" {
+		return TaskBackup
+	}
+	return s.Task
+}
+
+// Name returns the job name that backends derive labels, units and log files from
+func (s Spec) Name() string {
+	return JobName(s.Repo, s.TaskName())
+}
+
+// Command returns the command line the job runs. With gate set, the backup
+// only runs when the schedule fired recently (or, with CatchUp,
+// when a scheduled run was missed).
+func (s Spec) Command(gate bool) []string {
+	task := s.TaskName()
+	args := []string{s.Binary, task, s.Repo}
+	// --scheduled applies the repository's max_jitter delay and skips the
+	// run if another is in progress; prune has no jitter, so it only skips
+	if task != TaskPrune {
+		args = append(args, "--scheduled")
+	} else {
+		args = append(args, "--skip")
+	}
+	if task != TaskBackup {
+		return args
+	}
+	if gate || s.CatchUp {
+		args = append(args, "--when", s.Schedule)
+	}
+	if s.CatchUp {
+		args = append(args, "--catch-up")
+	}
+	return args
+}
+
+// EnvKeys returns the keys of Env in order
+func (s Spec) EnvKeys() []string {
+	keys := make([]string, 0, len(s.Env))
+	for key := range s.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FileMode returns the permissions for files holding the job, which are
+// private when the job carries environment variables
+func (s Spec) FileMode() os.FileMode {
+	if len(s.Env) > 0 {
+		return 0600
+	}
+	return 0644
+}
+
+// JobName returns the name of the job running a task for a repository.
+// Backup jobs are named after the repository, other tasks get a suffix,
+// e.g. "laptop.prune".
+func JobName(repoName, task string) string {
+	if task == "" || task == TaskBackup {
+		return repoName
+	}
+	return repoName + "." + task
+}
+
+// ParseJobName splits a job name into its repository and task
+func ParseJobName(name string) (string, string) {
+	for _, task := range Tasks {
+		if repoName, ok := strings.CutSuffix(name, "."+task); ok && task != TaskBackup {
+			return repoName, task
+		}
+	}
+	return name, TaskBackup
+}
+
+// File is a file written by a scheduler backend
+type File struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	Content string `json:"-"`
+}
+
+// Job is a scheduled job created by a backend, ready to be installed
+type Job struct {
+	Spec    Spec
+	Files   []File
+	Summary string
+}
+
+// Entry describes an installed scheduled job
+type Entry struct {
+	Repo           string `json:"repo"`
+	Task           string `json:"task"`
+	Backend        string `json:"backend"`
+	Schedule       string `json:"schedule,omitempty"`
+	StdoutPath     string `json:"stdout_path,omitempty"`
+	StderrPath     string `json:"stderr_path,omitempty"`
+	Loaded         bool   `json:"loaded"`
+	LastExitStatus *int   `json:"last_exit_status,omitempty"`
+	Files          []File `json:"files"`
+}
+
+// Scheduler creates, installs and removes scheduled backup jobs
+type Scheduler interface {
+	// Name returns the backend name, e.g. "launchd"
+	Name() string
+	// Create builds the job for a spec without touching the system
+	Create(spec Spec) (*Job, error)
+	// Install writes and activates a job created by Create
+	Install(job *Job) error
+	// Uninstall deactivates and removes a job by name (see JobName)
+	Uninstall(name string) error
+	// List returns all installed jobs
+	List() ([]Entry, error)
+	// Status returns an installed job by name, or ErrNotScheduled
+	Status(name string) (*Entry, error)
+}
+
+// Runner runs an external command, feeding stdin if non-nil, and returns its standard output.
+type Runner func(stdin []byte, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs commands with os/exec
+func ExecRunner(stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	return cmd.Output()
+}
+
+// DefaultBackend returns the native backend name for the current OS
+func DefaultBackend() string {
+	if runtime.GOOS == "darwin" {
+		return "launchd"
+	}
+	return "systemd"
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJobName(t *testing.T) {
+	tests := []struct {
+		repo, task, name string
+	}{
+		{"laptop", TaskBackup, "laptop"},
+		{"laptop", "", "laptop"},
+		{"laptop", TaskPrune, "laptop.prune"},
+		{"b2.photos", TaskCheck, "b2.photos.check"},
+	}
+	for _, tt := range tests {
+		name := JobName(tt.repo, tt.task)
+		if name != tt.name {
+			t.Errorf("JobName(%q, %q) = %q, want %q", tt.repo, tt.task, name, tt.name)
+		}
+
+		wantTask := tt.task
+		if wantTask == "" {
+			wantTask = TaskBackup
+		}
+		if repo, task := ParseJobName(name); repo != tt.repo || task != wantTask {
+			t.Errorf("ParseJobName(%q) = %q, %q, want %q, %q", name, repo, task, tt.repo, wantTask)
+		}
+	}
+}
+
+func TestSpecCommand(t *testing.T) {
+	tests := []struct {
+		spec Spec
+		gate bool
+		want string
+	}{
+		{Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "rh"}, false, "rh backup laptop --scheduled"},
+		{Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "rh"}, true, "rh backup laptop --scheduled --when 0 2 * * *"},
+		{Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "rh", CatchUp: true}, false, "rh backup laptop --scheduled --when 0 2 * * * --catch-up"},
+		{Spec{Repo: "laptop", Schedule: "0 4 * * 0", Binary: "rh", Task: TaskCheck}, false, "rh check laptop --scheduled"},
+		{Spec{Repo: "laptop", Schedule: "0 5 * * 0", Binary: "rh", Task: TaskPrune}, false, "rh prune laptop --skip"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.spec.Command(tt.gate), " "); got != tt.want {
+			t.Errorf("Command(%v) = %q, want %q", tt.gate, got, tt.want)
+		}
+	}
+}
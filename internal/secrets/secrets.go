@@ -0,0 +1,151 @@
+// Package secrets encrypts and decrypts secret files with age, using an
+// identity file as both the key to decrypt and the source of recipients.
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+// Ext is the file extension of age-encrypted files
+const Ext = ".age"
+
+// IsEncrypted reports whether path names an age-encrypted file
+func IsEncrypted(path string) bool {
+	return strings.HasSuffix(path, Ext)
+}
+
+// LoadIdentities reads the identities of an age identity file
+func LoadIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age identity: %w", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// Recipients returns the recipients that the identities can decrypt for
+func Recipients(identities []age.Identity) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(identities))
+	for _, identity := range identities {
+		switch id := identity.(type) {
+		case *age.X25519Identity:
+			recipients = append(recipients, id.Recipient())
+		case *age.HybridIdentity:
+			recipients = append(recipients, id.Recipient())
+		default:
+			return nil, fmt.Errorf("unsupported age identity type %T", identity)
+		}
+	}
+	return recipients, nil
+}
+
+// GenerateIdentity writes a new X25519 identity file in the age-keygen format
+func GenerateIdentity(path string) (*age.X25519Identity, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate age identity: %w", err)
+	}
+
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), identity.Recipient(), identity)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create identity directory: %w", err)
+	}
+	// O_EXCL so an existing identity is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create age identity: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return nil, fmt.Errorf("failed to write age identity: %w", err)
+	}
+	return identity, nil
+}
+
+// Decrypt decrypts age ciphertext with the identities
+func Decrypt(ciphertext []byte, identities []age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Encrypt encrypts plaintext to the recipients
+func Encrypt(plaintext []byte, recipients []age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptFile decrypts an age-encrypted file with the identity file
+func DecryptFile(path, identityPath string) ([]byte, error) {
+	identities, err := LoadIdentities(identityPath)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	plaintext, err := Decrypt(ciphertext, identities)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+// EncryptFile encrypts plaintext to the recipients of the identity file and
+// writes it to path atomically
+func EncryptFile(path string, plaintext []byte, identityPath string) error {
+	identities, err := LoadIdentities(identityPath)
+	if err != nil {
+		return err
+	}
+	recipients, err := Recipients(identities)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := Encrypt(plaintext, recipients)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, ciphertext, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	identity := filepath.Join(dir, "age.key")
+	if _, err := GenerateIdentity(identity); err != nil {
+		t.Fatalf("GenerateIdentity failed: %v", err)
+	}
+
+	path := filepath.Join(dir, "secret.toml.age")
+	plaintext := []byte("[telegram]\nbot_token = \"token\"\n")
+	if err := EncryptFile(path, plaintext, identity); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+
+	ciphertext, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ciphertext) == string(plaintext) {
+		t.Fatal("expected the file to be encrypted")
+	}
+
+	got, err := DecryptFile(path, identity)
+	if err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	if string(got) != string(plaintext) {
+		t.Errorf("DecryptFile = %q, want %q", got, plaintext)
+	}
+
+	other := filepath.Join(dir, "other.key")
+	if _, err := GenerateIdentity(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptFile(path, other); err == nil {
+		t.Error("expected decrypting with another identity to fail")
+	}
+}
+
+func TestGenerateIdentityKeepsExisting(t *testing.T) {
+	identity := filepath.Join(t.TempDir(), "age.key")
+	if _, err := GenerateIdentity(identity); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(identity)
+
+	if _, err := GenerateIdentity(identity); err == nil {
+		t.Error("expected an existing identity not to be overwritten")
+	}
+	if after, _ := os.ReadFile(identity); string(after) != string(before) {
+		t.Error("identity file changed")
+	}
+}
@@ -0,0 +1,140 @@
+// Package state persists per-repository run history in the state directory.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/restic"
+)
+
+// RepoState holds the recorded runs of a repository
+type RepoState struct {
+	// LastSuccess maps a task name ("backup", "check", "prune") to the time
+	// its last successful run finished
+	LastSuccess map[string]time.Time `json:"last_success"`
+	// Scheduled maps a task name to when its job was installed, which
+	// catch-up counts from until the task first succeeds
+	Scheduled map[string]time.Time `json:"scheduled,omitempty"`
+	// Backups are the summaries of the latest successful backups, oldest first
+	Backups []BackupRecord `json:"backups,omitempty"`
+}
+
+// BackupRecord is the summary of a backup and when it finished
+type BackupRecord struct {
+	Time time.Time `json:"time"`
+	restic.BackupSummary
+}
+
+// HistorySize is how many backup summaries are kept
+const HistorySize = 30
+
+// Path returns the state file path for a repository
+func Path(stateDir, repoName string) string {
+	return filepath.Join(stateDir, repoName+".state.json")
+}
+
+// Load reads the state of a repository; a missing file yields an empty state
+func Load(stateDir, repoName string) (*RepoState, error) {
+	s := &RepoState{LastSuccess: make(map[string]time.Time)}
+
+	data, err := os.ReadFile(Path(stateDir, repoName))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if s.LastSuccess == nil {
+		s.LastSuccess = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// Save writes the state of a repository atomically
+func Save(stateDir, repoName string, s *RepoState) error {
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	path := Path(stateDir, repoName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// RecordSuccess records that a task of a repository finished successfully at t
+func RecordSuccess(stateDir, repoName, task string, t time.Time) error {
+	s, err := Load(stateDir, repoName)
+	if err != nil {
+		return err
+	}
+	s.LastSuccess[task] = t
+	return Save(stateDir, repoName, s)
+}
+
+// RecordScheduled records that the job of a task was installed at t. With
+// keep, an earlier record is left alone.
+func RecordScheduled(stateDir, repoName, task string, t time.Time, keep bool) error {
+	s, err := Load(stateDir, repoName)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Scheduled[task]; ok && keep {
+		return nil
+	}
+	if s.Scheduled == nil {
+		s.Scheduled = make(map[string]time.Time)
+	}
+	s.Scheduled[task] = t
+	return Save(stateDir, repoName, s)
+}
+
+// RecordBackup records the summary of a backup that finished at t, keeping
+// the latest HistorySize
+func RecordBackup(stateDir, repoName string, summary restic.BackupSummary, t time.Time) error {
+	s, err := Load(stateDir, repoName)
+	if err != nil {
+		return err
+	}
+	s.Backups = append(s.Backups, BackupRecord{Time: t, BackupSummary: summary})
+	if len(s.Backups) > HistorySize {
+		s.Backups = s.Backups[len(s.Backups)-HistorySize:]
+	}
+	return Save(stateDir, repoName, s)
+}
+
+// CatchUpSince returns the time after which a missed fire time of a task is
+// caught up: its last success or, if it never succeeded, when its job was
+// installed. It returns false if neither is recorded.
+func (s *RepoState) CatchUpSince(task string) (time.Time, bool) {
+	if last, ok := s.LastSuccess[task]; ok {
+		return last, true
+	}
+	installed, ok := s.Scheduled[task]
+	return installed, ok
+}
+
+// Due reports whether a task is due: it never succeeded, or its last success
+// is at least interval before now
+func (s *RepoState) Due(task string, interval time.Duration, now time.Time) bool {
+	last, ok := s.LastSuccess[task]
+	return !ok || !now.Before(last.Add(interval))
+}
@@ -0,0 +1,122 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/restic"
+)
+
+func TestRecordSuccess(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Load(dir, "laptop")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(s.LastSuccess) != 0 {
+		t.Errorf("expected empty state, got %+v", s)
+	}
+
+	backupAt := time.Date(2026, 3, 2, 2, 40, 0, 0, time.UTC)
+	checkAt := backupAt.Add(time.Hour)
+	if err := RecordSuccess(dir, "laptop", "backup", backupAt); err != nil {
+		t.Fatalf("RecordSuccess() error = %v", err)
+	}
+	if err := RecordSuccess(dir, "laptop", "check", checkAt); err != nil {
+		t.Fatalf("RecordSuccess() error = %v", err)
+	}
+
+	s, err = Load(dir, "laptop")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !s.LastSuccess["backup"].Equal(backupAt) || !s.LastSuccess["check"].Equal(checkAt) {
+		t.Errorf("LastSuccess = %v, want backup=%v check=%v", s.LastSuccess, backupAt, checkAt)
+	}
+}
+
+func TestRecordBackup(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 2, 2, 0, 0, 0, time.UTC)
+
+	for i := range HistorySize + 2 {
+		summary := restic.BackupSummary{FilesNew: i, SnapshotID: "snap"}
+		if err := RecordBackup(dir, "laptop", summary, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("RecordBackup() error = %v", err)
+		}
+	}
+
+	s, err := Load(dir, "laptop")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(s.Backups) != HistorySize {
+		t.Fatalf("len(Backups) = %d, want %d", len(s.Backups), HistorySize)
+	}
+	last := s.Backups[HistorySize-1]
+	if last.FilesNew != HistorySize+1 || !last.Time.Equal(start.Add(time.Duration(HistorySize+1)*time.Hour)) {
+		t.Errorf("last backup = %+v", last)
+	}
+}
+
+func TestCatchUpSince(t *testing.T) {
+	dir := t.TempDir()
+	installedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	backupAt := installedAt.Add(24 * time.Hour)
+
+	if err := RecordScheduled(dir, "laptop", "backup", installedAt, false); err != nil {
+		t.Fatalf("RecordScheduled() error = %v", err)
+	}
+	// The daemon keeps the first record on every start
+	if err := RecordScheduled(dir, "laptop", "backup", backupAt, true); err != nil {
+		t.Fatalf("RecordScheduled() error = %v", err)
+	}
+
+	s, err := Load(dir, "laptop")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if since, ok := s.CatchUpSince("backup"); !ok || !since.Equal(installedAt) {
+		t.Errorf("CatchUpSince() before a success = %v, %v, want %v", since, ok, installedAt)
+	}
+	if _, ok := s.CatchUpSince("check"); ok {
+		t.Error("CatchUpSince() of a task never scheduled should be false")
+	}
+
+	if err := RecordSuccess(dir, "laptop", "backup", backupAt); err != nil {
+		t.Fatalf("RecordSuccess() error = %v", err)
+	}
+	if s, err = Load(dir, "laptop"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if since, ok := s.CatchUpSince("backup"); !ok || !since.Equal(backupAt) {
+		t.Errorf("CatchUpSince() after a success = %v, %v, want %v", since, ok, backupAt)
+	}
+}
+
+func TestDue(t *testing.T) {
+	pruneAt := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	s := &RepoState{LastSuccess: map[string]time.Time{"prune": pruneAt}}
+
+	tests := []struct {
+		name     string
+		task     string
+		interval time.Duration
+		now      time.Time
+		want     bool
+	}{
+		{"never ran", "check", week, pruneAt, true},
+		{"within interval", "prune", week, pruneAt.Add(6 * 24 * time.Hour), false},
+		{"interval passed", "prune", week, pruneAt.Add(week), true},
+		{"no interval", "prune", 0, pruneAt, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Due(tt.task, tt.interval, tt.now); got != tt.want {
+				t.Errorf("Due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
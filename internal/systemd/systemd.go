@@ -0,0 +1,352 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/catflyflyfly/restic-helpers/internal/config"
+	"github.com/catflyflyfly/restic-helpers/internal/cron"
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+)
+
+const (
+	unitPrefix = "restic-helpers-"
+)
+
+// Job represents a systemd user service and its timer
+type Job struct {
+	Name              string
+	Description       string
+	ExecStart         []string
+	OnCalendar        []string
+	Interval          time.Duration
+	StandardOutPath   string
+	StandardErrorPath string
+	// Persistent runs the service at boot if a calendar trigger was missed
+	Persistent bool
+	// Environment is a list of KEY=value assignments for the service
+	Environment []string
+}
+
+// GetUnitName returns the systemd unit name (without suffix) for a job name (see scheduler.JobName)
+func GetUnitName(name string) string {
+	return unitPrefix + name
+}
+
+// CreateJob creates a systemd job for scheduled backups
+func CreateJob(spec scheduler.Spec) (*Job, error) {
+	paths, err := config.GetPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := cron.Parse(spec.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		Name:              GetUnitName(spec.Name()),
+		Description:       fmt.Sprintf("restic-helpers %s for %s", spec.TaskName(), spec.Repo),
+		ExecStart:         spec.Command(false),
+		StandardOutPath:   filepath.Join(paths.StateDir, spec.Name()+".out.log"),
+		StandardErrorPath: filepath.Join(paths.StateDir, spec.Name()+".err.log"),
+		Persistent:        spec.CatchUp,
+	}
+	for _, key := range spec.EnvKeys() {
+		job.Environment = append(job.Environment, key+"="+spec.Env[key])
+	}
+
+	// "@every" intervals map to monotonic timers, everything else to OnCalendar
+	if schedule.Every > 0 {
+		if schedule.Every < time.Second {
+			return nil, fmt.Errorf("interval %v is shorter than one second", schedule.Every)
+		}
+		job.Interval = schedule.Every
+		return job, nil
+	}
+
+	job.OnCalendar, err = schedule.OnCalendar()
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// jobSummary describes the triggers of a job for verbose output
+func jobSummary(job *Job) string {
+	if job.Interval > 0 {
+		return fmt.Sprintf("Created OnUnitActiveSec of %v", job.Interval)
+	}
+	return fmt.Sprintf("Created %d OnCalendar entries", len(job.OnCalendar))
+}
+
+// EncodeService encodes a job to a systemd service unit
+func EncodeService(job *Job) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", job.Description)
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	for _, env := range job.Environment {
+		fmt.Fprintf(&b, "Environment=%s\n", quoteEnv(env))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", quoteArgs(job.ExecStart))
+	if job.StandardOutPath != "" {
+		fmt.Fprintf(&b, "StandardOutput=append:%s\n", job.StandardOutPath)
+	}
+	if job.StandardErrorPath != "" {
+		fmt.Fprintf(&b, "StandardError=append:%s\n", job.StandardErrorPath)
+	}
+	return b.String()
+}
+
+// EncodeTimer encodes a job to a systemd timer unit
+func EncodeTimer(job *Job) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s (timer)\n", job.Description)
+	b.WriteString("\n[Timer]\n")
+	for _, calendar := range job.OnCalendar {
+		fmt.Fprintf(&b, "OnCalendar=%s\n", calendar)
+	}
+	if job.Interval > 0 {
+		seconds := int(job.Interval / time.Second)
+		fmt.Fprintf(&b, "OnActiveSec=%ds\n", seconds)
+		fmt.Fprintf(&b, "OnUnitActiveSec=%ds\n", seconds)
+	}
+	if job.Persistent {
+		b.WriteString("Persistent=true\n")
+	}
+	fmt.Fprintf(&b, "Unit=%s.service\n", job.Name)
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=timers.target\n")
+	return b.String()
+}
+
+// quoteArgs joins arguments into an ExecStart command line
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteArg double-quotes an argument if it contains whitespace or quotes
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// quoteEnv double-quotes a KEY=value assignment, escaping % so it is not read
+// as a unit specifier
+func quoteEnv(env string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+	return `"` + r.Replace(env) + `"`
+}
+
+// Scheduler installs jobs as systemd user timers
+type Scheduler struct {
+	Dir string
+	Run scheduler.Runner
+}
+
+// NewScheduler returns a Scheduler for the user's systemd unit directory
+func NewScheduler() (*Scheduler, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	// systemd reads user units from $XDG_CONFIG_HOME/systemd/user
+	configHome := filepath.Join(homeDir, ".config")
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		configHome = dir
+	}
+	return &Scheduler{
+		Dir: filepath.Join(configHome, "systemd", "user"),
+		Run: scheduler.ExecRunner,
+	}, nil
+}
+
+// Name returns the backend name
+func (s *Scheduler) Name() string {
+	return "systemd"
+}
+
+// ServicePath returns the path to the service unit for a job name
+func (s *Scheduler) ServicePath(name string) string {
+	return filepath.Join(s.Dir, GetUnitName(name)+".service")
+}
+
+// TimerPath returns the path to the timer unit for a job name
+func (s *Scheduler) TimerPath(name string) string {
+	return filepath.Join(s.Dir, GetUnitName(name)+".timer")
+}
+
+// Create builds the service and timer units for a spec
+func (s *Scheduler) Create(spec scheduler.Spec) (*scheduler.Job, error) {
+	job, err := CreateJob(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Job{
+		Spec: spec,
+		Files: []scheduler.File{
+			{Kind: "systemd service", Path: s.ServicePath(spec.Name()), Content: EncodeService(job)},
+			{Kind: "systemd timer", Path: s.TimerPath(spec.Name()), Content: EncodeTimer(job)},
+		},
+		Summary: jobSummary(job),
+	}, nil
+}
+
+// Install writes the service and timer units and enables the timer
+func (s *Scheduler) Install(job *scheduler.Job) error {
+	// Ensure systemd user directory exists
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create systemd user directory: %w", err)
+	}
+
+	// Write unit files
+	for _, f := range job.Files {
+		if err := os.WriteFile(f.Path, []byte(f.Content), job.Spec.FileMode()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Kind, err)
+		}
+	}
+
+	// Reload and enable the timer
+	if err := s.systemctl("daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	if err := s.systemctl("enable", "--now", GetUnitName(job.Spec.Name())+".timer"); err != nil {
+		return fmt.Errorf("failed to enable systemd timer: %w", err)
+	}
+
+	return nil
+}
+
+// Uninstall disables the timer and removes the unit files
+func (s *Scheduler) Uninstall(name string) error {
+	timerPath := s.TimerPath(name)
+	if _, err := os.Stat(timerPath); os.IsNotExist(err) {
+		return scheduler.ErrNotScheduled
+	}
+
+	// Disable the timer (ignore errors if not enabled)
+	_ = s.systemctl("disable", "--now", GetUnitName(name)+".timer")
+
+	// Remove the unit files
+	for _, path := range []string{timerPath, s.ServicePath(name)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove unit: %w", err)
+		}
+	}
+
+	_ = s.systemctl("daemon-reload")
+
+	return nil
+}
+
+// List returns all restic-helpers timers in the unit directory
+func (s *Scheduler) List() ([]scheduler.Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, unitPrefix+"*.timer"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]scheduler.Entry, 0, len(matches))
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), ".timer")
+		entry, err := s.Status(strings.TrimPrefix(name, unitPrefix))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// Status returns the installed units with the given job name
+func (s *Scheduler) Status(name string) (*scheduler.Entry, error) {
+	repoName, task := scheduler.ParseJobName(name)
+	entry := &scheduler.Entry{Repo: repoName, Task: task, Backend: s.Name()}
+
+	for _, f := range []scheduler.File{
+		{Kind: "systemd service", Path: s.ServicePath(name)},
+		{Kind: "systemd timer", Path: s.TimerPath(name)},
+	} {
+		content, err := os.ReadFile(f.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Kind, err)
+		}
+		f.Content = string(content)
+		entry.Files = append(entry.Files, f)
+	}
+
+	if len(entry.Files) == 0 {
+		return nil, scheduler.ErrNotScheduled
+	}
+
+	var calendars []string
+	for _, f := range entry.Files {
+		for _, line := range strings.Split(f.Content, "\n") {
+			key, value, _ := strings.Cut(line, "=")
+			switch key {
+			case "OnCalendar":
+				calendars = append(calendars, value)
+			case "OnUnitActiveSec":
+				if d, err := time.ParseDuration(value); err == nil {
+					calendars = append(calendars, "@every "+d.String())
+				}
+			case "StandardOutput":
+				entry.StdoutPath = strings.TrimPrefix(value, "append:")
+			case "StandardError":
+				entry.StderrPath = strings.TrimPrefix(value, "append:")
+			}
+		}
+	}
+	entry.Schedule = strings.Join(calendars, "; ")
+
+	unitName := GetUnitName(name)
+	if err := s.systemctl("is-active", "--quiet", unitName+".timer"); err == nil {
+		entry.Loaded = true
+	}
+	if out, err := s.Run(nil, "systemctl", "--user", "show", unitName+".service", "--property=ExecMainStartTimestamp,ExecMainStatus"); err == nil {
+		props := parseProperties(string(out))
+		// ExecMainStatus is 0 until the service has run, so require a start timestamp
+		if status, err := strconv.Atoi(props["ExecMainStatus"]); err == nil && props["ExecMainStartTimestamp"] != "" {
+			entry.LastExitStatus = &status
+		}
+	}
+
+	return entry, nil
+}
+
+// parseProperties parses the Key=Value lines printed by `systemctl show`
+func parseProperties(out string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// systemctl runs a systemctl command against the user manager
+func (s *Scheduler) systemctl(args ...string) error {
+	_, err := s.Run(nil, "systemctl", append([]string{"--user"}, args...)...)
+	return err
+}
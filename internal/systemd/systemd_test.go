@@ -0,0 +1,177 @@
+package systemd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/catflyflyfly/restic-helpers/internal/scheduler"
+)
+
+// recorder is a stub scheduler.Runner that records the commands it receives.
+type recorder struct {
+	commands []string
+	outputs  map[string]string
+}
+
+func (r *recorder) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, command)
+	return []byte(r.outputs[command]), nil
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *recorder) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	rec := &recorder{}
+	return &Scheduler{Dir: filepath.Join(t.TempDir(), "systemd", "user"), Run: rec.run}, rec
+}
+
+func TestSchedulerInstallUninstall(t *testing.T) {
+	s, rec := newTestScheduler(t)
+
+	job, err := s.Create(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/opt/restic helpers/restic-helpers"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	service, err := os.ReadFile(s.ServicePath("laptop"))
+	if err != nil {
+		t.Fatalf("service not written: %v", err)
+	}
+	if !strings.Contains(string(service), `ExecStart="/opt/restic helpers/restic-helpers" backup laptop`) {
+		t.Errorf("service has unexpected ExecStart:\n%s", service)
+	}
+
+	timer, err := os.ReadFile(s.TimerPath("laptop"))
+	if err != nil {
+		t.Fatalf("timer not written: %v", err)
+	}
+	if !strings.Contains(string(timer), "OnCalendar=*-*-* 02:00:00\n") {
+		t.Errorf("timer has unexpected OnCalendar:\n%s", timer)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Repo != "laptop" || len(entries[0].Files) != 2 {
+		t.Errorf("List() = %+v, want one entry for laptop with two files", entries)
+	}
+
+	if err := s.Uninstall("laptop"); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	for _, path := range []string{s.ServicePath("laptop"), s.TimerPath("laptop")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after Uninstall()", path)
+		}
+	}
+
+	want := []string{
+		"systemctl --user daemon-reload",
+		"systemctl --user enable --now restic-helpers-laptop.timer",
+		"systemctl --user is-active --quiet restic-helpers-laptop.timer",
+		"systemctl --user show restic-helpers-laptop.service --property=ExecMainStartTimestamp,ExecMainStatus",
+		"systemctl --user disable --now restic-helpers-laptop.timer",
+		"systemctl --user daemon-reload",
+	}
+	if strings.Join(rec.commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", rec.commands, want)
+	}
+}
+
+func TestSchedulerStatus(t *testing.T) {
+	s, rec := newTestScheduler(t)
+	rec.outputs = map[string]string{
+		"systemctl --user show restic-helpers-laptop.service --property=ExecMainStartTimestamp,ExecMainStatus": "ExecMainStartTimestamp=Mon 2026-01-05 02:00:00 UTC\nExecMainStatus=1\n",
+	}
+
+	job, err := s.Create(scheduler.Spec{Repo: "laptop", Schedule: "0 3 1 * 0", Binary: "/usr/local/bin/restic-helpers"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	entry, err := s.Status("laptop")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if want := "*-*-01 03:00:00; Sun *-*-* 03:00:00"; entry.Schedule != want {
+		t.Errorf("Schedule = %q, want %q", entry.Schedule, want)
+	}
+	if !strings.HasSuffix(entry.StdoutPath, "laptop.out.log") || !strings.HasSuffix(entry.StderrPath, "laptop.err.log") {
+		t.Errorf("log paths = %q, %q", entry.StdoutPath, entry.StderrPath)
+	}
+	if !entry.Loaded || entry.LastExitStatus == nil || *entry.LastExitStatus != 1 {
+		t.Errorf("Loaded = %v, LastExitStatus = %v, want loaded with status 1", entry.Loaded, entry.LastExitStatus)
+	}
+}
+
+func TestSchedulerNotScheduled(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	if _, err := s.Status("missing"); !errors.Is(err, scheduler.ErrNotScheduled) {
+		t.Errorf("Status() error = %v, want ErrNotScheduled", err)
+	}
+	if err := s.Uninstall("missing"); !errors.Is(err, scheduler.ErrNotScheduled) {
+		t.Errorf("Uninstall() error = %v, want ErrNotScheduled", err)
+	}
+}
+
+func TestCreateJobCatchUp(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	job, err := CreateJob(scheduler.Spec{Repo: "laptop", Schedule: "0 2 * * *", Binary: "/usr/local/bin/restic-helpers", CatchUp: true})
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	if timer := EncodeTimer(job); !strings.Contains(timer, "Persistent=true\n") {
+		t.Errorf("timer is not persistent:\n%s", timer)
+	}
+	if service := EncodeService(job); !strings.Contains(service, `backup laptop --scheduled --when "0 2 * * *" --catch-up`) {
+		t.Errorf("service has unexpected ExecStart:\n%s", service)
+	}
+}
+
+func TestInstallEnvironment(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	job, err := s.Create(scheduler.Spec{
+		Repo:     "laptop",
+		Schedule: "0 2 * * *",
+		Binary:   "/usr/local/bin/restic-helpers",
+		Env:      map[string]string{"XDG_CONFIG_HOME": `/srv/50% "off"`, "XDG_STATE_HOME": "/srv/state"},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Install(job); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	service, err := os.ReadFile(s.ServicePath("laptop"))
+	if err != nil {
+		t.Fatalf("service not written: %v", err)
+	}
+	want := "Environment=\"XDG_CONFIG_HOME=/srv/50%% \\\"off\\\"\"\nEnvironment=\"XDG_STATE_HOME=/srv/state\"\n"
+	if !strings.Contains(string(service), want) {
+		t.Errorf("service has unexpected Environment, want %q:\n%s", want, service)
+	}
+
+	info, err := os.Stat(s.ServicePath("laptop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("service mode = %v, want 0600", info.Mode().Perm())
+	}
+}